@@ -0,0 +1,227 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP endpoints for reading DDRM's view of the records
+const (
+	ddrmHttpPathApiRecords string = "/api/records"
+	ddrmHttpPathApiConfig  string = "/api/config"
+)
+
+// A record as the API describes it, with its config and everything DDRM knows about it
+type DdrmApiRecord struct {
+	Config  DdrmRecordConfig   `json:"config"`
+	State   DdrmRecordState    `json:"state"`
+	History []DdrmHistoryEntry `json:"history,omitempty"`
+}
+
+// The records the API serves at /api/records
+type DdrmApiRecords struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	Records     []DdrmApiRecord `json:"records"`
+}
+
+// The API's error responses
+type DdrmApiError struct {
+	Error string `json:"error"`
+}
+
+func setupApi() {
+	ddrmHttpMux.HandleFunc(ddrmHttpPathApiRecords, handleApiRecords)
+	ddrmHttpMux.HandleFunc(ddrmHttpPathApiRecords+"/", handleApiRecord)
+	ddrmHttpMux.HandleFunc(ddrmHttpPathApiConfig, handleApiConfig)
+}
+
+// reading is open to anyone, so only GET is allowed unless an endpoint says otherwise
+func allowGetOnly(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+
+	methodNotAllowed(w, http.MethodGet)
+
+	return false
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeJSON(w, http.StatusMethodNotAllowed, DdrmApiError{Error: http.StatusText(http.StatusMethodNotAllowed)})
+}
+
+// read and check a record config sent to the API, answering with why it can't be used if it can't
+func readApiRecordConfig(w http.ResponseWriter, r *http.Request) (record DdrmRecordConfig, ok bool) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&record); err != nil {
+		writeJSON(w, http.StatusBadRequest, DdrmApiError{Error: fmt.Sprintf(ddrmErrorRecordChangeBody, err)})
+		return record, false
+	}
+
+	if err := validateRecordConfig(record); err != nil {
+		writeJSON(w, http.StatusBadRequest, DdrmApiError{Error: err.Error()})
+		return record, false
+	}
+
+	return record, true
+}
+
+// answer a change to the records with the record as it is now, or why the change couldn't be made
+func writeApiRecordChange(w http.ResponseWriter, status int, record DdrmRecordConfig, err error) {
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, DdrmApiError{Error: err.Error()})
+		return
+	}
+
+	writeJSON(w, status, DdrmApiRecord{Config: record, State: getRecordState(record.FQDN + ":" + string(record.Type))})
+}
+
+// every configured record along with its state, in the order they're configured
+func apiRecords() []DdrmApiRecord {
+	states := recordStatesSnapshot()
+	configs := recordConfigs()
+	records := make([]DdrmApiRecord, 0, len(configs))
+
+	for _, record := range configs {
+		state := states[record.FQDN+":"+string(record.Type)]
+		state.FQDN, state.Type = record.FQDN, record.Type
+
+		records = append(records, DdrmApiRecord{Config: record, State: state})
+	}
+
+	return records
+}
+
+// GET /api/records lists every record's config and current state,
+// and POST /api/records with a record config starts monitoring it
+func handleApiRecords(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, DdrmApiRecords{GeneratedAt: time.Now(), Records: apiRecords()})
+	case http.MethodPost:
+		requireApiToken(handleApiAddRecord)(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func handleApiAddRecord(w http.ResponseWriter, r *http.Request, name string) {
+	record, ok := readApiRecordConfig(w, r)
+
+	if !ok {
+		return
+	}
+
+	if _, found := recordConfig(record.FQDN, record.Type); found {
+		writeJSON(w, http.StatusConflict, DdrmApiError{Error: fmt.Sprintf(ddrmErrorDuplicateRecord, record.FQDN, string(record.Type))})
+		return
+	}
+
+	writeApiRecordChange(w, http.StatusCreated, record, addRecord(record, name))
+}
+
+// GET /api/records/<fqdn>/<type> describes a single record, PUT replaces its config,
+// and DELETE stops monitoring it
+func handleApiRecord(w http.ResponseWriter, r *http.Request) {
+	path, _ := strings.CutPrefix(r.URL.Path, ddrmHttpPathApiRecords+"/")
+	fqdn, recordType, found := strings.Cut(path, "/")
+
+	if !found {
+		writeJSON(w, http.StatusNotFound, DdrmApiError{Error: ddrmErrorApiRecordPath})
+		return
+	}
+
+	record, found := recordConfig(fqdn, DdrmRecordType(strings.ToUpper(recordType)))
+
+	if !found {
+		writeJSON(w, http.StatusNotFound, DdrmApiError{Error: http.StatusText(http.StatusNotFound)})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		handleApiGetRecord(w, r, record)
+	case http.MethodPut:
+		requireApiToken(func(w http.ResponseWriter, r *http.Request, name string) {
+			handleApiUpdateRecord(w, r, name, record)
+		})(w, r)
+	case http.MethodDelete:
+		requireApiToken(func(w http.ResponseWriter, r *http.Request, name string) {
+			if err := removeRecord(record.FQDN, record.Type, name); err != nil {
+				writeJSON(w, http.StatusInternalServerError, DdrmApiError{Error: err.Error()})
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func handleApiUpdateRecord(w http.ResponseWriter, r *http.Request, name string, existing DdrmRecordConfig) {
+	record, ok := readApiRecordConfig(w, r)
+
+	if !ok {
+		return
+	}
+
+	// moving a record onto another one would leave two records sharing their state
+	moved := record.FQDN != existing.FQDN || record.Type != existing.Type
+	if _, found := recordConfig(record.FQDN, record.Type); moved && found {
+		writeJSON(w, http.StatusConflict, DdrmApiError{Error: fmt.Sprintf(ddrmErrorDuplicateRecord, record.FQDN, string(record.Type))})
+		return
+	}
+
+	writeApiRecordChange(w, http.StatusOK, record, updateRecord(existing.FQDN, existing.Type, record, name))
+}
+
+// include the newest history entries, up to the count query parameter
+func handleApiGetRecord(w http.ResponseWriter, r *http.Request, config DdrmRecordConfig) {
+	count := ddrmHistoryShown
+	if r.URL.Query().Has("count") {
+		parsed, err := strconv.ParseInt(r.URL.Query().Get("count"), 10, 64)
+
+		if err != nil || parsed < 0 {
+			writeJSON(w, http.StatusBadRequest, DdrmApiError{Error: ddrmErrorApiHistoryCount})
+			return
+		}
+
+		count = parsed
+	}
+
+	record := DdrmApiRecord{Config: config, State: getRecordState(config.FQDN + ":" + string(config.Type))}
+	record.State.FQDN, record.State.Type = config.FQDN, config.Type
+
+	if count > 0 {
+		history, err := getCachedHistory(record.Config.FQDN, record.Config.Type, count)
+
+		if err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, DdrmApiError{Error: err.Error()})
+			return
+		}
+
+		record.History = history
+	}
+
+	writeJSON(w, http.StatusOK, record)
+}
+
+// GET /api/config lists the records DDRM has loaded, which never include any secrets
+func handleApiConfig(w http.ResponseWriter, r *http.Request) {
+	if !allowGetOnly(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, recordConfigs())
+}
@@ -0,0 +1,151 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"slices"
+	"time"
+)
+
+// A record's new baseline, and who approved it
+type DdrmApproval struct {
+	FQDN        string         `json:"fqdn"`
+	Type        DdrmRecordType `json:"type"`
+	Values      []string       `json:"values"`
+	PriorValues []string       `json:"prior_values"`
+	By          string         `json:"by"`
+	At          time.Time      `json:"at"`
+}
+
+// The CLI subcommand for approving a record's current answer as its new baseline
+const ddrmSubcommandApprove string = "approve"
+
+// find the config for a record
+func recordConfig(fqdn string, recordType DdrmRecordType) (record DdrmRecordConfig, found bool) {
+	for _, r := range recordConfigs() {
+		if r.FQDN == fqdn && r.Type == recordType {
+			return r, true
+		}
+	}
+
+	return
+}
+
+// whether a record is compared against the cached values, so that it has a baseline that can change
+func followsCache(record DdrmRecordConfig) bool {
+	return recordMatchMode(record) == ddrmMatchExact && !hasPatterns(record.ExpectedValues)
+}
+
+// who's running DDRM, for approvals made from the TUI or CLI
+func localUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return "unknown"
+}
+
+// make a record's values its new baseline in the cache, and record who approved them and when
+func approveRecord(fqdn string, recordType DdrmRecordType, values []string, by string) (approval DdrmApproval, err error) {
+	record, found := recordConfig(fqdn, recordType)
+
+	if !found {
+		return approval, fmt.Errorf(ddrmErrorUnknownRecord, fqdn, string(recordType))
+	}
+
+	if !stateUseCache {
+		return approval, errors.New(ddrmErrorApprovalNeedsCache)
+	}
+
+	if !followsCache(record) {
+		return approval, fmt.Errorf(ddrmErrorApprovalNoBaseline, fqdn, string(recordType))
+	}
+
+	if len(values) == 0 {
+		return approval, fmt.Errorf(ddrmErrorApprovalNoValues, fqdn, string(recordType))
+	}
+
+	values = slices.Clone(values)
+	slices.Sort(values)
+
+	// until something's been approved or followed along with, the baseline is the startup config
+	prior, err := getCachedValues(fqdn, recordType)
+
+	if err != nil {
+		return approval, err
+	}
+
+	if len(prior) == 0 {
+		prior = literalValues(record.ExpectedValues)
+	}
+
+	approval = DdrmApproval{
+		FQDN:        fqdn,
+		Type:        recordType,
+		Values:      values,
+		PriorValues: prior,
+		By:          by,
+		At:          time.Now(),
+	}
+
+	if err = setCachedValues(fqdn, recordType, values); err != nil {
+		return approval, fmt.Errorf(ddrmErrorApprovalNotSaved, fqdn, string(recordType), err)
+	}
+
+	if err = addCachedApproval(approval); err != nil {
+		return approval, err
+	}
+
+	dbgf(ddrmReportApproved, fqdn, string(recordType), values, by)
+
+	// don't wait for the next cycle to stop showing the change as unacknowledged
+	key := fqdn + ":" + string(recordType)
+	state := getRecordState(key)
+
+	if state.FQDN != "" && slices.Equal(state.CurrentValues, values) {
+		state.Changed = false
+		state.Unacknowledged = false
+		state.PriorValues = values
+	}
+
+	state.ApprovedBy = approval.By
+	state.ApprovedAt = approval.At
+
+	if state.FQDN != "" {
+		setRecordState(key, state)
+	}
+
+	return approval, nil
+}
+
+// approve <fqdn> <type> [approver], using the record's answer right now as its new baseline
+func runApproveSubcommand() {
+	fqdn, recordType, by := flag.Arg(1), DdrmRecordType(flag.Arg(2)), flag.Arg(3)
+
+	if by == "" {
+		by = localUsername()
+	}
+
+	record, found := recordConfig(fqdn, recordType)
+
+	if !found {
+		fmt.Fprintf(os.Stderr, ddrmErrorUnknownRecord+"\n", fqdn, string(recordType))
+		os.Exit(ddrmExitErrorRunningSubcommand)
+	}
+
+	approval, err := approveRecord(fqdn, recordType, getRecordData(record).Values, by)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(ddrmExitErrorRunningSubcommand)
+	}
+
+	fmt.Printf(ddrmReportApproved+"\n", approval.FQDN, string(approval.Type), approval.Values, approval.By)
+	os.Exit(ddrmExitOK)
+}
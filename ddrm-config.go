@@ -8,6 +8,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
@@ -16,75 +18,210 @@ import (
 
 // Type to describe the JSON app config on disk
 type DdrmAppConfig struct {
-	EmailUser           string `json:"email_user"`
-	EmailUserName       string `json:"email_user_name"`
-	EmailPassword       string `json:"email_password"`
-	EmailServerHostname string `json:"email_server_hostname"`
-	EmailServerPort     string `json:"email_server_port"`
-	EmailTo             string `json:"email_to"`
-	EmailToName         string `json:"email_to_name"`
-	DnsServer1          string `json:"dns_server_1"`
-	DnsServer2          string `json:"dns_server_2"`
-	EmailSenderName     string `json:"email_sender_name"`
-	EmailLink           string `json:"email_link"`
-	EmailLogo           string `json:"email_logo"`
-	EmailSubject        string `json:"email_subject"`
-	RedisDatabase       int    `json:"redis_database"`
-	RedisPassword       string `json:"redis_password"`
-	RedisServer         string `json:"redis_server"`
-	RedisKeyPrefix      string `json:"redis_key_prefix"`
+	EmailUser             string            `json:"email_user"`
+	EmailUserName         string            `json:"email_user_name"`
+	EmailPassword         string            `json:"email_password"`
+	EmailServerHostname   string            `json:"email_server_hostname"`
+	EmailServerPort       string            `json:"email_server_port"`
+	EmailTo               string            `json:"email_to"`
+	EmailToName           string            `json:"email_to_name"`
+	DnsServer1            string            `json:"dns_server_1"`
+	DnsServer2            string            `json:"dns_server_2"`
+	DnsServers            []string          `json:"dns_servers"`
+	EmailSenderName       string            `json:"email_sender_name"`
+	EmailLink             string            `json:"email_link"`
+	EmailLogo             string            `json:"email_logo"`
+	EmailSubject          string            `json:"email_subject"`
+	RedisDatabase         int               `json:"redis_database"`
+	RedisPassword         string            `json:"redis_password"`
+	RedisServer           string            `json:"redis_server"`
+	RedisKeyPrefix        string            `json:"redis_key_prefix"`
+	RedisMode             string            `json:"redis_mode"`
+	RedisServers          []string          `json:"redis_servers"`
+	RedisUsername         string            `json:"redis_username"`
+	RedisSentinelMaster   string            `json:"redis_sentinel_master"`
+	RedisSentinelUsername string            `json:"redis_sentinel_username"`
+	RedisSentinelPassword string            `json:"redis_sentinel_password"`
+	RedisTls              bool              `json:"redis_tls"`
+	RedisTlsCaFile        string            `json:"redis_tls_ca_file"`
+	RedisTlsCertFile      string            `json:"redis_tls_cert_file"`
+	RedisTlsKeyFile       string            `json:"redis_tls_key_file"`
+	RedisTlsServerName    string            `json:"redis_tls_server_name"`
+	DnssecTrustAnchors    []string          `json:"dnssec_trust_anchors"`
+	DnssecExpiryWarning   string            `json:"dnssec_expiry_warning"`
+	DnsTlsCaFile          string            `json:"dns_tls_ca_file"`
+	HttpListen            string            `json:"http_listen"`
+	HttpTlsCertFile       string            `json:"http_tls_cert_file"`
+	HttpTlsKeyFile        string            `json:"http_tls_key_file"`
+	ApiTokens             map[string]string `json:"api_tokens"`
+	HistoryLength         int64             `json:"history_length"`
+	StateStore            string            `json:"state_store"`
+	StateFile             string            `json:"state_file"`
+	CacheExpiry           string            `json:"cache_expiry"`
+	LeaderLease           string            `json:"leader_lease"`
+	InstanceName          string            `json:"instance_name"`
+	ReadyMaxCycleAge      string            `json:"ready_max_cycle_age"`
+	ReadyMaxEmailFailures int               `json:"ready_max_email_failures"`
 }
 
 // Type to describe the record checking JSON config on disk
 type DdrmRecordConfig struct {
-	FQDN           string         `json:"fqdn"`
-	Type           DdrmRecordType `json:"type"`
-	ExpectedValues []string       `json:"expected_values"`
+	FQDN               string              `json:"fqdn"`
+	Type               DdrmRecordType      `json:"type"`
+	ExpectedValues     []string            `json:"expected_values"`
+	Consensus          DdrmConsensusPolicy `json:"consensus,omitempty"`
+	Authoritative      bool                `json:"authoritative,omitempty"`
+	Dnssec             bool                `json:"dnssec,omitempty"`
+	TargetOnly         bool                `json:"target_only,omitempty"`
+	MinTTL             uint32              `json:"min_ttl,omitempty"`
+	MaxTTL             uint32              `json:"max_ttl,omitempty"`
+	SerialStaleAfter   string              `json:"serial_stale_after,omitempty"`
+	ExpectResponse     DdrmResponse        `json:"expect_response,omitempty"`
+	AlertAfterFailures int                 `json:"alert_after_failures,omitempty"`
+	Match              DdrmMatchMode       `json:"match,omitempty"`
+	ForbiddenValues    []string            `json:"forbidden_values,omitempty"`
+	Confirmations      int                 `json:"confirmations,omitempty"`
+	FlapThreshold      int                 `json:"flap_threshold,omitempty"`
+	FlapWindow         string              `json:"flap_window,omitempty"`
 }
 
 // State constants
 const (
-	ddrmConfigFilePath        string = "ddrm.conf"
-	ddrmRecordsConfigFilePath string = "ddrm-records.conf"
-	ddrmEmailTemplatePath     string = "ddrm-email-template.txt"
-	ddrmStartupBanner         string = "DNS Spy Record Monitor %s %s (git %s) built by %s"
-	ddrmConfigPathBanner      string = "config path: %s"
-	ddrmRecordsPathBanner     string = "records config path: %s"
-	ddrmDebugMode             string = "debug mode enabled"
+	ddrmConfigFilePath         string = "ddrm.conf"
+	ddrmRecordsConfigFilePath  string = "ddrm-records.conf"
+	ddrmEmailTemplatePath      string = "ddrm-email-template.txt"
+	ddrmStartupBanner          string = "DNS Spy Record Monitor %s %s (git %s) built by %s"
+	ddrmConfigPathBanner       string = "config path: %s"
+	ddrmRecordsPathBanner      string = "records config path: %s"
+	ddrmDebugMode              string = "debug mode enabled"
+	ddrmForbiddenSubjectPrefix string = "[HIGH SEVERITY] "
 )
 
 // Error messages
 const (
-	ddrmErrorNoConfigPath          string = "no configuration file at path: %s"
-	ddrmErrorNoRecordsPath         string = "no records configuration file at path %s"
-	ddrmErrorUnableToReadFile      string = "unable to read file: %s %#v"
-	ddrmErrorUnableToStatFile      string = "unable to stat file: %s %#v"
-	ddrmErrorInsecureConfig        string = "insecure config: %s %#v"
-	ddrmErrorSendingMail           string = "unable to send email"
-	ddrmErrorUnableToGenerateEmail string = "unable to generate email report to send"
-	ddrmErrorUnableToUnmarshalJSON string = "unable to unmarshal JSON from %s %#v"
-	ddrmErrorUnableToRunLoop       string = "unable to process main run loop"
-	ddrmErrorUnableToFetchRecord   string = "unable to fetch record data for %s %s"
+	ddrmErrorNoConfigPath             string = "no configuration file at path: %s"
+	ddrmErrorNoRecordsPath            string = "no records configuration file at path %s"
+	ddrmErrorUnableToReadFile         string = "unable to read file: %s %#v"
+	ddrmErrorUnableToStatFile         string = "unable to stat file: %s %#v"
+	ddrmErrorInsecureConfig           string = "insecure config: %s %#v"
+	ddrmErrorSendingMail              string = "unable to send email"
+	ddrmErrorUnableToGenerateEmail    string = "unable to generate email report to send"
+	ddrmErrorUnableToUnmarshalJSON    string = "unable to unmarshal JSON from %s %#v"
+	ddrmErrorUnableToRunLoop          string = "unable to process main run loop"
+	ddrmErrorUnableToFetchRecord      string = "unable to fetch record data for %s %s"
+	ddrmErrorResolversDisagree        string = "resolvers disagree about %s %s"
+	ddrmErrorNoAuthoritativeServers   string = "unable to find authoritative servers for %s"
+	ddrmErrorNoNameserverAddress      string = "no address for nameserver %s"
+	ddrmErrorInvalidTrustAnchor       string = "invalid DNSSEC trust anchor %q: %v"
+	ddrmErrorDnssecNoData             string = "no DNSSEC data to validate for %s %s"
+	ddrmErrorDnssecNoSignatures       string = "no RRSIG covering %s %s"
+	ddrmErrorDnssecNoValidSignature   string = "no valid RRSIG covering %s %s"
+	ddrmErrorDnssecSignerOutOfZone    string = "RRSIG covering %s %s is signed by %s, which isn't a zone containing it"
+	ddrmErrorDnssecSignatureOutOfDate string = "RRSIG covering %s %s is only valid from %s until %s"
+	ddrmErrorDnssecNoMatchingKey      string = "no DNSKEY for %s matches its DS"
+	ddrmErrorDnssecNoTrustAnchor      string = "no trust anchor covers %s"
+	ddrmErrorDnssecNoDS               string = "no DS for signing zone %s"
+	ddrmErrorDnssecExpiringSoon       string = "an RRSIG in the chain of trust expires at %s"
+	ddrmErrorDnssecAlert              string = "DNSSEC is %s for %s %s: %s"
+	ddrmErrorUnknownRecordType        string = "unknown record type %q for %s"
+	ddrmErrorTTLOutOfBounds           string = "TTL out of bounds for %s %s: %s"
+	ddrmErrorSOASerial                string = "SOA serial problem for %s: %s"
+	ddrmErrorResponseRcode            string = "%s responded with %s"
+	ddrmErrorUnexpectedResponse       string = "unexpected response for %s %s: %s instead of %s"
+	ddrmErrorUnknownExpectedResponse  string = "unknown expected response %q for %s, expecting NXDOMAIN or NODATA"
+	ddrmErrorUnknownTransport         string = "unknown transport %q for resolver %s"
+	ddrmErrorInvalidMatcher           string = "invalid expected value %q: %v"
+	ddrmErrorCIDRNotAddress           string = "expected value %q is a CIDR but %s records aren't addresses"
+	ddrmErrorInvalidExpectedValues    string = "invalid expected values for %s %s: %v"
+	ddrmErrorUnknownMatchMode         string = "unknown match mode %q, expecting exact, subset or superset"
+	ddrmErrorForbiddenValues          string = "forbidden values for %s %s: %v"
+	ddrmErrorRecordFlapping           string = "%s %s is flapping, %d changes in its window"
+	ddrmErrorNoCertificatesInBundle   string = "no certificates found in CA bundle %s"
+	ddrmErrorDoHStatus                string = "%s responded with HTTP status %s"
+	ddrmErrorDoQShortResponse         string = "short DNS-over-QUIC response from %s"
+	ddrmErrorUnknownSubcommand        string = "unknown subcommand: %s"
+	ddrmErrorUnknownRecord            string = "no record config for %s %s"
+	ddrmErrorApprovalNeedsCache       string = "approving a baseline needs the cache, use -cache"
+	ddrmErrorApprovalNoBaseline       string = "%s %s is matched against its expected_values, so its baseline can only be changed in the records config"
+	ddrmErrorApprovalNoValues         string = "no values to approve for %s %s"
+	ddrmErrorApprovalNotSaved         string = "unable to save the new baseline for %s %s: %v"
+	ddrmErrorUnacknowledgedChange     string = "unacknowledged change for %s %s: %v"
+	ddrmErrorHttpServer               string = "unable to run HTTP server: %v"
+	ddrmErrorHttpTlsFiles             string = "http_tls_cert_file and http_tls_key_file need to be set together"
+	ddrmErrorUnknownStateStore        string = "unknown state_store %q, expecting redis, file or memory"
+	ddrmErrorRedisConfig              string = "invalid Redis config: %v"
+	ddrmErrorRedisNoClient            string = "no Redis client, since the Redis config is invalid"
+	ddrmErrorUnknownRedisMode         string = "unknown redis_mode %q, expecting standalone, sentinel or cluster"
+	ddrmErrorRedisNoSentinelMaster    string = "redis_sentinel_master is needed for sentinel mode"
+	ddrmErrorRedisClusterDatabase     string = "redis_database must be 0 for cluster mode"
+	ddrmErrorRedisUnreachable         string = "unable to connect to Redis at %s: %v"
+	ddrmErrorInvalidCacheExpiry       string = "invalid cache_expiry %q: %v"
+	ddrmErrorCache                    string = "cache error for %s %s: %v"
+	ddrmErrorInvalidLeaderLease       string = "invalid leader_lease %q"
+	ddrmErrorLeaderLease              string = "unable to renew the leader lease: %v"
+	ddrmErrorInvalidReadyMaxCycleAge  string = "invalid ready_max_cycle_age %q: %v"
+	ddrmErrorApiRecordPath            string = "records are addressed as /api/records/<fqdn>/<type>"
+	ddrmErrorApiHistoryCount          string = "count must be a whole number of history entries"
+	ddrmErrorInvalidRecordConfig      string = "invalid record config in %s: %v"
+	ddrmErrorMinTTLNeedsAuthoritative string = "min_ttl for %s %s needs authoritative, since resolvers count TTLs down as their caches age"
+	ddrmErrorRecordNoFQDN             string = "records need an fqdn"
+	ddrmErrorDuplicateRecord          string = "%s %s is already monitored"
+	ddrmErrorSavingRecords            string = "unable to save records to %s: %v"
+	ddrmErrorRecordChangeBody         string = "unable to read the record config: %v"
+	ddrmErrorInvalidDuration          string = "invalid %s %q: %v"
+	ddrmErrorDurationNotPositive      string = "needs to be longer than zero"
+	ddrmErrorUnknownConsensus         string = "unknown consensus %q for %s %s, expecting all, majority or any"
+	ddrmErrorTrustAnchorNotDS         string = "DNSSEC trust anchor %q isn't a DS record"
+	ddrmErrorReloadingConfig          string = "unable to reload config, carrying on with the current one: %v"
+	ddrmErrorWebTemplate              string = "unable to render the %s page of the web UI: %v"
+	ddrmErrorOpeningStateFile         string = "unable to open state file %s: %v"
+	ddrmErrorStateFileInUse           string = "state file %s is in use by a running DDRM, so %s can't open it: use the TUI, /approve or /api/records instead"
+	ddrmErrorSubcommandMemoryStore    string = "the memory state store only exists inside a running DDRM, so %s can't use it: use the TUI, /approve or /api/records instead"
+	ddrmErrorHistoryNeedsCache        string = "record history is kept in the cache, use -cache"
 )
 
 // Debug messages
 const (
-	ddrmDebugStartProcessing    string = "  processing records for: %s %s"
-	ddrmDebugRetrievedDataFrom  string = "fetched record data from: %s"
-	ddrmDebugEndProcessing      string = "   end of processing for: %s %s"
-	ddrmDebugTryingCache        string = "        trying cache for: %s %s"
-	ddrmDebugNoCache            string = "    no cached values for: %s %s"
-	ddrmDebugUsingStartupConfig string = "using startup config for: %s %s"
+	ddrmDebugStartProcessing      string = "  processing records for: %s %s"
+	ddrmDebugRetrievedDataFrom    string = "fetched record data from: %s"
+	ddrmDebugEndProcessing        string = "   end of processing for: %s %s"
+	ddrmDebugTryingCache          string = "        trying cache for: %s %s"
+	ddrmDebugNoCache              string = "    no cached values for: %s %s"
+	ddrmDebugUsingStartupConfig   string = "using startup config for: %s %s"
+	ddrmDebugAuthoritativeServers string = "authoritative servers for: %s %v"
+	ddrmDebugFollowerNotSending   string = "  following, so not sending: %s"
 )
 
 // Success and reporting messages
 const (
-	ddrmSuccessSentMail     string = "sent email report successfully"
-	ddrmReportReadingConfig string = "reading config: %s"
-	ddrmReportReadConfig    string = "successfully read config: %s"
-	ddrmReportReadRecords   string = "read %d record(s) to process"
-	ddrmReportDNSClientErr  string = "error asking %s for %s %s record: %#v"
-	ddrmSuccessSetupCronJob string = "setup periodic processing for %s (%s): %s"
+	ddrmSuccessSentMail          string = "sent email report successfully"
+	ddrmReportReadingConfig      string = "reading config: %s"
+	ddrmReportReadConfig         string = "successfully read config: %s"
+	ddrmReportReadRecords        string = "read %d record(s) to process"
+	ddrmReportDNSClientErr       string = "error asking %s for %s %s record: %#v"
+	ddrmSuccessSetupCronJob      string = "setup periodic processing for %s (%s): %s"
+	ddrmReportTTLBelowMinimum    string = "%s has TTL %d, below the minimum of %d"
+	ddrmReportTTLAboveMaximum    string = "%s has TTL %d, above the maximum of %d"
+	ddrmReportSOAFieldChanged    string = "%s changed from %s to %s"
+	ddrmReportSOASerialRegressed string = "serial went backwards from %d to %d"
+	ddrmReportSOASerialStale     string = "serial %d hasn't changed for %s"
+	ddrmReportSOASerialMismatch  string = "servers have different serials: %s"
+	ddrmReportFlapSummary        string = "%d changes in the last %s:"
+	ddrmReportApproved           string = "approved %s %s with %v as its baseline, by %s"
+	ddrmReportRecordAdded        string = "added %s %s, by %s"
+	ddrmReportRecordUpdated      string = "updated %s %s, by %s"
+	ddrmReportRecordRemoved      string = "removed %s %s, by %s"
+	ddrmReportRecordSaved        string = "saved %s %s, checking it now"
+	ddrmReportReloading          string = "reloading config after %s"
+	ddrmReportReloaded           string = "reloaded config: %d record(s) added, %d changed, %d removed"
+	ddrmReportReloadNeedsRestart string = "%s has changed, which needs a restart to take effect"
+	ddrmReportConfirmRemove      string = "press y to stop monitoring %s %s, or any other key to cancel"
+	ddrmReportHistoryEntry       string = "%s  %-8s  %s -> %s  (%s)"
+	ddrmReportHistoryShown       string = "%d history entries for %s %s"
+	ddrmReportRedisConnected     string = "connected to Redis (%s): %s"
+	ddrmReportLeadership         string = "%s is now the %s"
+	ddrmReportUsingStateStore    string = "using state store: %s"
+	ddrmReportAwaitingApproval   string = "This change is unacknowledged, and will be reported every cycle until it's approved as the record's new baseline."
 )
 
 // os.Exit() return codes to indicate exit state on error
@@ -97,6 +234,11 @@ const (
 	ddrmExitErrorCreatingScheduler
 	ddrmExitErrorCreatingUIUpdateJob
 	ddrmExitErrorCreatingRecordProcessorJob
+	ddrmExitErrorRunningSubcommand
+	ddrmExitErrorConnectingToRedis
+	ddrmExitErrorCreatingLeaderJob
+	ddrmExitErrorCreatingWatchJob
+	ddrmExitErrorStartingHttpServer
 )
 
 // Application runtime state
@@ -117,19 +259,26 @@ var (
 	stateAllowImpreciseMatch   bool          = false
 	stateExpand                bool          = false
 	stateTabsToSpaces          int           = 4
-	stateUseRedis              bool          = false
+	stateUseCache              bool          = false
 	stateUI                    bool          = false
 	stateLogRecordProcessing   bool          = false
 	stateUITickRate            time.Duration = 1 * time.Second
 	stateAltScreenMode         bool          = false
 	statePrintVersion          bool          = false
+	stateWorkers               int           = 1
+	stateResolverQPS           float64       = 0
+	stateRequireApproval       bool          = false
+	stateWatchInterval         time.Duration = 0
 )
 
-// unmarshalled application config
-var ddrmAppConfig DdrmAppConfig
+// unmarshalled application config, which is swapped out as a whole when the config is reloaded
+var ddrmAppConfig atomic.Pointer[DdrmAppConfig]
 
-// unmarshalled record configs
-var ddrmRecordConfig []DdrmRecordConfig
+// unmarshalled record configs, which can be changed at runtime through the API and TUI
+var (
+	ddrmRecordConfig     []DdrmRecordConfig
+	ddrmRecordConfigLock sync.RWMutex
+)
 
 // logger and scheduler objects
 var (
@@ -137,63 +286,122 @@ var (
 	cronScheduler gocron.Scheduler
 )
 
+// the application config in use, which is never changed once it's been published, so read
+// it once and keep the result when several settings need to belong together
+func appConfig() *DdrmAppConfig {
+	if config := ddrmAppConfig.Load(); config != nil {
+		return config
+	}
+
+	return &DdrmAppConfig{}
+}
+
 // Defensively try and read a config file and return the raw bytes
 // Full os.Exit() if it fails
 func readFileReturningBytes(filePath string) []byte {
+	if filePath == "" {
+		dbgf(ddrmErrorNoConfigPath, filePath)
+		os.Exit(ddrmExitDuringConfig)
+	}
 
-	var config []byte
+	config, err := readConfigFile(filePath)
 
-	if filePath != "" {
-		// check if the file exists and we can stat it
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			dbgf(ddrmErrorUnableToReadFile, filePath, err)
-			os.Exit(ddrmExitDuringConfig)
-		}
+	if err != nil {
+		dbg(err.Error())
+		os.Exit(ddrmExitDuringConfig)
+	}
 
-		stat, err := os.Lstat(filePath)
+	return config
+}
 
-		if err != nil {
-			dbgf(ddrmErrorUnableToStatFile, filePath, err)
-			os.Exit(ddrmExitDuringConfig)
-		}
+// read a config file, refusing to if anyone other than its owner could read or change it
+func readConfigFile(filePath string) ([]byte, error) {
+	// check if the file exists and we can stat it
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf(ddrmErrorUnableToReadFile, filePath, err)
+	}
 
-		if stat.Mode() != 0400 {
-			if !stateInsecureConfig {
-				dbgf(ddrmErrorInsecureConfig, filePath, stat.Mode().Perm().String())
-				os.Exit(ddrmExitDuringConfig)
-			}
-		}
+	stat, err := os.Lstat(filePath)
 
-		dbgf(ddrmReportReadingConfig, filePath)
+	if err != nil {
+		return nil, fmt.Errorf(ddrmErrorUnableToStatFile, filePath, err)
+	}
 
-		config, err = os.ReadFile(filePath)
-		if err != nil {
-			dbgf(ddrmErrorUnableToReadFile, filePath, err)
-			os.Exit(ddrmExitDuringConfig)
+	if stat.Mode() != 0400 {
+		if !stateInsecureConfig {
+			return nil, fmt.Errorf(ddrmErrorInsecureConfig, filePath, stat.Mode().Perm().String())
 		}
+	}
 
-	} else {
-		dbgf(ddrmErrorNoConfigPath, filePath)
-		os.Exit(ddrmExitDuringConfig)
+	dbgf(ddrmReportReadingConfig, filePath)
+
+	config, err := os.ReadFile(filePath)
+
+	if err != nil {
+		return nil, fmt.Errorf(ddrmErrorUnableToReadFile, filePath, err)
 	}
 
-	return config
+	return config, nil
+}
+
+// read and parse the app config, without touching the one in use
+func loadAppConfig(filePath string) (config DdrmAppConfig, err error) {
+	raw, err := readConfigFile(filePath)
+
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(raw, &config); err != nil {
+		return config, fmt.Errorf(ddrmErrorUnableToUnmarshalJSON, filePath, err)
+	}
+
+	// refuse DNSSEC settings that would otherwise quietly fall back to the defaults
+	err = validateDnssecConfig(config)
+
+	return
+}
+
+// read, parse and check the record configs, without touching the ones in use
+func loadRecordsConfig(filePath string) (records []DdrmRecordConfig, err error) {
+	raw, err := readConfigFile(filePath)
+
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(raw, &records); err != nil {
+		return nil, fmt.Errorf(ddrmErrorUnableToUnmarshalJSON, filePath, err)
+	}
+
+	// refuse records we'd never be able to interpret, or that are monitored twice and would share their state
+	if err = validateRecordSet(records); err != nil {
+		return nil, fmt.Errorf(ddrmErrorInvalidRecordConfig, filePath, err)
+	}
+
+	return
 }
 
 func readAppConfig() {
 	if stateConfigFilePath != "" {
 
-		config := readFileReturningBytes(stateConfigFilePath)
-
-		err := json.Unmarshal(config, &ddrmAppConfig)
+		config, err := loadAppConfig(stateConfigFilePath)
 
 		if err != nil {
-			dbgf(ddrmErrorUnableToUnmarshalJSON, stateConfigFilePath, err)
+			dbg(err.Error())
 			os.Exit(ddrmExitDuringConfig)
 		}
 
+		ddrmAppConfig.Store(&config)
+
 		dbgf(ddrmReportReadConfig, stateConfigFilePath)
 
+		// approved baselines are kept in the cache, so there's nowhere to keep them without it
+		if stateRequireApproval && !stateUseCache {
+			dbg(ddrmErrorApprovalNeedsCache)
+			os.Exit(ddrmExitDuringConfig)
+		}
+
 	} else {
 		dbgf(ddrmErrorNoConfigPath, stateConfigFilePath)
 		os.Exit(ddrmExitDuringConfig)
@@ -205,15 +413,15 @@ func readRecordsConfig() {
 
 	if stateRecordsConfigFilePath != "" {
 
-		config := readFileReturningBytes(stateRecordsConfigFilePath)
-
-		err := json.Unmarshal(config, &ddrmRecordConfig)
+		records, err := loadRecordsConfig(stateRecordsConfigFilePath)
 
 		if err != nil {
-			dbgf(ddrmErrorUnableToUnmarshalJSON, stateRecordsConfigFilePath, err)
+			dbg(err.Error())
 			os.Exit(ddrmExitDuringConfig)
 		}
 
+		ddrmRecordConfig = records
+
 		dbgf(ddrmReportReadRecords, len(ddrmRecordConfig))
 		dbgf(ddrmReportReadConfig, stateRecordsConfigFilePath)
 
@@ -272,9 +480,42 @@ func setupPeriodicTasks() {
 		os.Exit(ddrmExitErrorCreatingUIUpdateJob)
 	}
 
+	// keep renewing the leader lease well within its duration, so it only lapses when we stop
+	if leaderElection() {
+		renewLeadership()
+
+		job, err = cron.NewJob(
+			gocron.DurationJob(leaderLease()/3),
+			gocron.NewTask(renewLeadership),
+			gocron.WithSingletonMode(gocron.LimitModeReschedule),
+		)
+
+		if err != nil {
+			os.Exit(ddrmExitErrorCreatingLeaderJob)
+		}
+
+		dbgf(ddrmSuccessSetupCronJob, "renewing leader lease", (leaderLease() / 3).String(), job.ID().String())
+	}
+
+	if stateWatchInterval > 0 {
+		job, err = cron.NewJob(
+			gocron.DurationJob(stateWatchInterval),
+			gocron.NewTask(watchConfigFiles),
+			gocron.WithSingletonMode(gocron.LimitModeReschedule),
+		)
+
+		if err != nil {
+			os.Exit(ddrmExitErrorCreatingWatchJob)
+		}
+
+		dbgf(ddrmSuccessSetupCronJob, "watching config files", stateWatchInterval.String(), job.ID().String())
+	}
+
+	// don't start another processing cycle while the last one is still going
 	job, err = cron.NewJob(
 		gocron.DurationJob(stateSleep),
 		gocron.NewTask(processRecords),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
 	)
 
 	dbgf(ddrmSuccessSetupCronJob, "processing records", stateSleep.String(), job.ID().String())
@@ -304,11 +545,15 @@ func parseCliFlags() {
 	flag.BoolVar(&stateAllowImpreciseMatch, "imprecise", stateAllowImpreciseMatch, "Allow imprecise string matches")
 	flag.BoolVar(&stateExpand, "expand", stateExpand, "Expand tabs and quoted characters in results")
 	flag.IntVar(&stateTabsToSpaces, "tabs", stateTabsToSpaces, "Number of spaces to expand tabs to")
-	flag.BoolVar(&stateUseRedis, "cache", stateUseRedis, "Use Redis for persistent rolling update cache")
+	flag.BoolVar(&stateUseCache, "cache", stateUseCache, "Use the state store for persistent rolling update cache")
 	flag.BoolVar(&stateUI, "ui", stateUI, "Draw the UI")
 	flag.BoolVar(&stateLogRecordProcessing, "logrecords", stateLogRecordProcessing, "Log record processing results")
 	flag.DurationVar(&stateUITickRate, "uirate", stateUITickRate, "Seconds between UI updates")
 	flag.BoolVar(&statePrintVersion, "version", statePrintVersion, "Print version and exit")
+	flag.IntVar(&stateWorkers, "workers", stateWorkers, "Number of records to process concurrently")
+	flag.Float64Var(&stateResolverQPS, "qps", stateResolverQPS, "Maximum queries per second to send to each resolver, 0 for no limit")
+	flag.BoolVar(&stateRequireApproval, "approval", stateRequireApproval, "Keep alerting about changes until they're approved as the new baseline")
+	flag.DurationVar(&stateWatchInterval, "watch", stateWatchInterval, "Seconds between checking the config files for changes to reload, 0 to only reload on SIGHUP")
 	flag.Parse()
 }
 
@@ -349,3 +594,18 @@ func dbgp(v ...interface{}) {
 		ddrmLog.Print(v...)
 	}
 }
+
+// run a CLI subcommand if one follows the flags, and exit when it's done
+func runSubcommand() {
+	switch flag.Arg(0) {
+	case "":
+		return
+	case ddrmSubcommandApprove:
+		runApproveSubcommand()
+	case ddrmSubcommandHistory:
+		runHistorySubcommand()
+	default:
+		fmt.Fprintf(os.Stderr, ddrmErrorUnknownSubcommand+"\n", flag.Arg(0))
+		os.Exit(ddrmExitErrorRunningSubcommand)
+	}
+}
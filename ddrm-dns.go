@@ -4,7 +4,15 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/miekg/dns"
 )
@@ -14,20 +22,133 @@ type DdrmRecordType string
 
 const (
 	//lint:ignore U1000 Ignore unused types: they are used during JSON parsing but go-staticcheck gets upset because it can't know that
-	ddrmRecordTypeA     DdrmRecordType = "A"
-	ddrmRecordTypeAAAA  DdrmRecordType = "AAAA"
-	ddrmRecordTypeTXT   DdrmRecordType = "TXT"
-	ddrmRecordTypeMX    DdrmRecordType = "MX"
-	ddrmRecordTypeCAA   DdrmRecordType = "CAA"
-	ddrmRecordTypeCNAME DdrmRecordType = "CNAME"
-	ddrmRecordTypeNS    DdrmRecordType = "NS"
-	ddrmRecordTypePTR   DdrmRecordType = "PTR"
-	ddrmRecordTypeSOA   DdrmRecordType = "SOA"
-	ddrmRecordTypeSRV   DdrmRecordType = "SRV"
+	ddrmRecordTypeA       DdrmRecordType = "A"
+	ddrmRecordTypeAAAA    DdrmRecordType = "AAAA"
+	ddrmRecordTypeTXT     DdrmRecordType = "TXT"
+	ddrmRecordTypeMX      DdrmRecordType = "MX"
+	ddrmRecordTypeCAA     DdrmRecordType = "CAA"
+	ddrmRecordTypeCNAME   DdrmRecordType = "CNAME"
+	ddrmRecordTypeNS      DdrmRecordType = "NS"
+	ddrmRecordTypePTR     DdrmRecordType = "PTR"
+	ddrmRecordTypeSOA     DdrmRecordType = "SOA"
+	ddrmRecordTypeSRV     DdrmRecordType = "SRV"
+	ddrmRecordTypeDS      DdrmRecordType = "DS"
+	ddrmRecordTypeDNSKEY  DdrmRecordType = "DNSKEY"
+	ddrmRecordTypeTLSA    DdrmRecordType = "TLSA"
+	ddrmRecordTypeSSHFP   DdrmRecordType = "SSHFP"
+	ddrmRecordTypeHTTPS   DdrmRecordType = "HTTPS"
+	ddrmRecordTypeSVCB    DdrmRecordType = "SVCB"
+	ddrmRecordTypeNAPTR   DdrmRecordType = "NAPTR"
+	ddrmRecordTypeCDS     DdrmRecordType = "CDS"
+	ddrmRecordTypeCDNSKEY DdrmRecordType = "CDNSKEY"
+	ddrmRecordTypeDNAME   DdrmRecordType = "DNAME"
+	ddrmRecordTypeLOC     DdrmRecordType = "LOC"
+	ddrmRecordTypeURI     DdrmRecordType = "URI"
 )
 
-// try and ask a question to get a record's records
-func getRecordData(fqdn string, recordtype DdrmRecordType) (answer []string) {
+// Every record type we know how to interpret, used to validate the records config
+var ddrmRecordTypes = []DdrmRecordType{
+	ddrmRecordTypeA,
+	ddrmRecordTypeAAAA,
+	ddrmRecordTypeTXT,
+	ddrmRecordTypeMX,
+	ddrmRecordTypeCAA,
+	ddrmRecordTypeCNAME,
+	ddrmRecordTypeNS,
+	ddrmRecordTypePTR,
+	ddrmRecordTypeSOA,
+	ddrmRecordTypeSRV,
+	ddrmRecordTypeDS,
+	ddrmRecordTypeDNSKEY,
+	ddrmRecordTypeTLSA,
+	ddrmRecordTypeSSHFP,
+	ddrmRecordTypeHTTPS,
+	ddrmRecordTypeSVCB,
+	ddrmRecordTypeNAPTR,
+	ddrmRecordTypeCDS,
+	ddrmRecordTypeCDNSKEY,
+	ddrmRecordTypeDNAME,
+	ddrmRecordTypeLOC,
+	ddrmRecordTypeURI,
+}
+
+// Policy describing how answers from multiple resolvers have to agree
+type DdrmConsensusPolicy string
+
+const (
+	//lint:ignore U1000 Ignore unused types: they are used during JSON parsing
+	ddrmConsensusAll      DdrmConsensusPolicy = "all"
+	ddrmConsensusMajority DdrmConsensusPolicy = "majority"
+	ddrmConsensusAny      DdrmConsensusPolicy = "any"
+)
+
+// The kind of response a resolver gave: its Rcode, NODATA for an empty NOERROR answer,
+// or how the exchange failed if there wasn't a response at all
+type DdrmResponse string
+
+const (
+	ddrmResponseNoError  DdrmResponse = "NOERROR"
+	ddrmResponseNoData   DdrmResponse = "NODATA"
+	ddrmResponseNXDomain DdrmResponse = "NXDOMAIN"
+	ddrmResponseServFail DdrmResponse = "SERVFAIL"
+	ddrmResponseRefused  DdrmResponse = "REFUSED"
+	ddrmResponseTimeout  DdrmResponse = "TIMEOUT"
+	ddrmResponseError    DdrmResponse = "ERROR"
+)
+
+// What a single resolver told us, with the TTL it gave for each value
+type DdrmResolverAnswer struct {
+	Resolver string            `json:"resolver"`
+	Values   []string          `json:"values"`
+	TTLs     map[string]uint32 `json:"ttls"`
+	Response DdrmResponse      `json:"response"`
+	Err      error             `json:"-"`
+}
+
+// errors don't encode to JSON on their own, so the API gets the error's message instead
+func (a DdrmResolverAnswer) MarshalJSON() ([]byte, error) {
+	type answer DdrmResolverAnswer
+
+	encoded := struct {
+		answer
+		Error string `json:"error,omitempty"`
+	}{answer: answer(a)}
+
+	if a.Err != nil {
+		encoded.Error = a.Err.Error()
+	}
+
+	return json.Marshal(encoded)
+}
+
+// What all of the resolvers told us, and what we decided the answer is
+type DdrmRecordAnswer struct {
+	Values    []string
+	Resolver  string
+	TTLs      map[string]uint32
+	Response  DdrmResponse
+	Resolvers []DdrmResolverAnswer
+	Disagree  bool
+}
+
+// When each resolver can next be asked a question, shared by all of the record processing workers
+var (
+	resolverNextQuery     = map[string]time.Time{}
+	resolverNextQueryLock sync.Mutex
+)
+
+// the resolvers to query for every record, falling back to the legacy single server config
+func dnsResolvers() []string {
+	config := appConfig()
+
+	if len(config.DnsServers) > 0 {
+		return config.DnsServers
+	}
+
+	return []string{config.DnsServer1}
+}
+
+func newDnsClient() *dns.Client {
 	dnsclient := new(dns.Client)
 	dnsclient.Net = "udp"
 
@@ -45,64 +166,364 @@ func getRecordData(fqdn string, recordtype DdrmRecordType) (answer []string) {
 
 	dnsclient.Timeout = stateDNSTimeout
 
-	dnsType := dns.StringToType[string(recordtype)]
+	return dnsclient
+}
 
+func newQuestion(fqdn string, recordtype DdrmRecordType) *dns.Msg {
 	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(fqdn), dnsType)
+	msg.SetQuestion(dns.Fqdn(fqdn), dns.StringToType[string(recordtype)])
 
-	in, _, err := dnsclient.Exchange(msg, ddrmAppConfig.DnsServer1)
+	return msg
+}
 
-	if err != nil {
-		dbgf(ddrmReportDNSClientErr, ddrmAppConfig.DnsServer1, fqdn, recordtype, err)
+// ask a single resolver a question, falling back to the second legacy server if it errors
+func queryResolver(server string, record DdrmRecordConfig) (answer DdrmResolverAnswer) {
+	msg := newQuestion(record.FQDN, record.Type)
+
+	answer = queryServer(server, msg, record.TargetOnly)
+
+	if answer.Err != nil {
+		dbgf(ddrmReportDNSClientErr, server, record.FQDN, record.Type, answer.Err)
 
-		// try the second configured DNS server if it's configured
-		if len(ddrmAppConfig.DnsServer2) > 0 {
-			in, _, err = dnsclient.Exchange(msg, ddrmAppConfig.DnsServer2)
+		// try the second configured DNS server if it's configured and we're using the legacy config
+		if config := appConfig(); len(config.DnsServers) == 0 && len(config.DnsServer2) > 0 {
+			answer = queryServer(config.DnsServer2, msg, record.TargetOnly)
 		}
+	}
 
-		if err != nil {
-			return nil
+	return
+}
+
+// ask an authoritative server directly, without asking it to recurse on our behalf
+func queryAuthoritative(server string, record DdrmRecordConfig) (answer DdrmResolverAnswer) {
+	msg := newQuestion(record.FQDN, record.Type)
+	msg.RecursionDesired = false
+
+	answer = queryServer(server, msg, record.TargetOnly)
+
+	if answer.Err != nil {
+		dbgf(ddrmReportDNSClientErr, server, record.FQDN, record.Type, answer.Err)
+	}
+
+	return
+}
+
+// wait until a resolver can be asked another question without going over -qps
+func waitForResolver(server string) {
+	if stateResolverQPS <= 0 {
+		return
+	}
+
+	interval := time.Duration(float64(time.Second) / stateResolverQPS)
+
+	resolverNextQueryLock.Lock()
+
+	now := time.Now()
+	next := resolverNextQuery[server]
+
+	if next.Before(now) {
+		next = now
+	}
+
+	resolverNextQuery[server] = next.Add(interval)
+
+	resolverNextQueryLock.Unlock()
+
+	time.Sleep(next.Sub(now))
+}
+
+// send a question to a server and get the full response, retrying over TCP if it was truncated
+func exchange(server string, msg *dns.Msg) (in *dns.Msg, err error) {
+	waitForResolver(server)
+	// encrypted transports have their own framing, so never get truncated
+	if isResolverURL(server) {
+		return exchangeURL(server, msg)
+	}
+
+	dnsclient := newDnsClient()
+
+	in, _, err = dnsclient.Exchange(msg, server)
+
+	if err == nil && in.Truncated && !stateTCP {
+		dnsclient.Net = strings.Replace(dnsclient.Net, "udp", "tcp", 1)
+		in, _, err = dnsclient.Exchange(msg, server)
+	}
+
+	return
+}
+
+// send a question to a server and turn the answer section into strings
+// MX, SRV and CAA records are compared in full unless only their targets were asked for
+func queryServer(server string, msg *dns.Msg, targetOnly bool) (result DdrmResolverAnswer) {
+	result.Resolver = server
+
+	in, err := exchange(server, msg)
+
+	if err != nil {
+		result.Err = err
+		result.Response = ddrmResponseError
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			result.Response = ddrmResponseTimeout
 		}
+
+		return
 	}
 
-	answer = []string{}
+	result.Response = DdrmResponse(dns.RcodeToString[in.Rcode])
+
+	// NXDOMAIN is an answer, but anything else that isn't NOERROR means the server couldn't give us one
+	if in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+		result.Err = fmt.Errorf(ddrmErrorResponseRcode, server, string(result.Response))
+		return
+	}
+
+	answer := []string{}
+	ttls := map[string]uint32{}
+
+	// keep the TTL of every value we add to the answer
+	add := func(rr dns.RR, value string) {
+		value = stringProcessor(value)
+		answer = append(answer, value)
+		ttls[value] = rr.Header().Ttl
+	}
 
 	for _, r := range in.Answer {
 		switch t := r.(type) {
 		case *dns.A:
-			answer = append(answer, stringProcessor(t.A.String()))
+			add(t, t.A.String())
 		case *dns.AAAA:
-			answer = append(answer, stringProcessor(t.AAAA.String()))
+			add(t, t.AAAA.String())
 		case *dns.CNAME:
-			answer = append(answer, stringProcessor(t.Target))
+			add(t, t.Target)
 		case *dns.CAA:
-			answer = append(answer, stringProcessor(t.Value))
+			if targetOnly {
+				add(t, t.Value)
+			} else {
+				add(t, rdata(t))
+			}
 		case *dns.MX:
-			answer = append(answer, stringProcessor(t.Mx))
+			if targetOnly {
+				add(t, t.Mx)
+			} else {
+				add(t, rdata(t))
+			}
 		case *dns.TXT:
 			for _, txt := range t.Txt {
-				answer = append(answer, stringProcessor(txt))
+				add(t, txt)
 			}
 		case *dns.NS:
-			answer = append(answer, stringProcessor(t.Ns))
+			add(t, t.Ns)
 		case *dns.PTR:
-			answer = append(answer, stringProcessor(t.Ptr))
+			add(t, t.Ptr)
 		case *dns.SRV:
-			answer = append(answer, stringProcessor(t.Target))
+			if targetOnly {
+				add(t, t.Target)
+			} else {
+				add(t, rdata(t))
+			}
 		case *dns.SOA:
-			answer = append(answer, stringProcessor(t.String()))
+			add(t, rdata(t))
+		case *dns.DS, *dns.DNSKEY, *dns.TLSA, *dns.SSHFP, *dns.HTTPS, *dns.SVCB,
+			*dns.NAPTR, *dns.CDS, *dns.CDNSKEY, *dns.LOC, *dns.URI:
+			add(t, rdata(t))
+		case *dns.DNAME:
+			add(t, t.Target)
+		}
+	}
+
+	slices.Sort(answer)
+
+	if in.Rcode == dns.RcodeSuccess && len(answer) == 0 {
+		result.Response = ddrmResponseNoData
+	}
+
+	result.Values = answer
+	result.TTLs = ttls
+
+	return
+}
+
+// the presentation format of a record without its owner, TTL, class and type
+func rdata(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// find the nameservers for the zone that fqdn lives in by walking up the labels until
+// something has NS records, then resolve each of them to an address we can query
+func authoritativeServers(fqdn string) (servers []DdrmResolverAnswer) {
+	resolver := dnsResolvers()[0]
+	name := dns.Fqdn(fqdn)
+
+	var nameservers []string
+
+	for {
+		in, err := exchange(resolver, newQuestion(name, ddrmRecordTypeNS))
+
+		if err == nil {
+			for _, r := range in.Answer {
+				if ns, ok := r.(*dns.NS); ok {
+					nameservers = append(nameservers, ns.Ns)
+				}
+			}
+		}
+
+		if len(nameservers) > 0 {
+			break
+		}
+
+		next, end := dns.NextLabel(name, 0)
+		if end {
+			dbgf(ddrmErrorNoAuthoritativeServers, fqdn)
+			return nil
+		}
+
+		name = name[next:]
+	}
+
+	slices.Sort(nameservers)
+
+	addressType := ddrmRecordTypeA
+	if stateIPV6 && !stateIPV4 {
+		addressType = ddrmRecordTypeAAAA
+	}
+
+	for _, ns := range nameservers {
+		addresses := queryResolver(resolver, DdrmRecordConfig{FQDN: ns, Type: addressType})
+		err := addresses.Err
+
+		if err == nil && len(addresses.Values) == 0 {
+			err = fmt.Errorf(ddrmErrorNoNameserverAddress, ns)
+		}
+
+		server := DdrmResolverAnswer{Resolver: ns, Err: err, Response: ddrmResponseError}
+		if err == nil {
+			server.Resolver = ns + " " + net.JoinHostPort(addresses.Values[0], "53")
 		}
+
+		servers = append(servers, server)
 	}
 
-	return answer
+	dbgf(ddrmDebugAuthoritativeServers, name, nameservers)
+
+	return servers
+}
+
+// try and ask every configured resolver, or every authoritative server, in parallel to get a record's records
+func getRecordData(record DdrmRecordConfig) (answer DdrmRecordAnswer) {
+	var servers []DdrmResolverAnswer
+
+	query := queryResolver
+
+	if record.Authoritative {
+		servers = authoritativeServers(record.FQDN)
+		query = queryAuthoritative
+	} else {
+		for _, resolver := range dnsResolvers() {
+			servers = append(servers, DdrmResolverAnswer{Resolver: resolver})
+		}
+	}
+
+	answer.Resolvers = make([]DdrmResolverAnswer, len(servers))
+
+	var wg sync.WaitGroup
+
+	for i, server := range servers {
+		// servers we couldn't find an address for keep their error and don't get asked
+		if server.Err != nil {
+			answer.Resolvers[i] = server
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, server DdrmResolverAnswer) {
+			defer wg.Done()
+			result := query(serverAddress(server.Resolver), record)
+			result.Resolver = server.Resolver
+			answer.Resolvers[i] = result
+		}(i, server)
+	}
+
+	wg.Wait()
+
+	agreed, disagree := resolverConsensus(record.Consensus, answer.Resolvers)
+
+	answer.Values = agreed.Values
+	answer.TTLs = agreed.TTLs
+	answer.Response = agreed.Response
+	answer.Resolver = agreed.Resolver
+	answer.Disagree = disagree
+
+	return
+}
+
+// authoritative servers are labelled "<nameserver> <address>:<port>" so reports can say
+// who answered, but we only want to send the question to the address
+func serverAddress(label string) string {
+	if i := strings.LastIndex(label, " "); i >= 0 {
+		return label[i+1:]
+	}
+
+	return label
+}
+
+// decide what the answer is from the resolvers that responded, based on the record's policy
+// resolvers that errored don't get a vote, and if none responded the answer is nil with the first failure
+func resolverConsensus(policy DdrmConsensusPolicy, answers []DdrmResolverAnswer) (agreed DdrmResolverAnswer, disagree bool) {
+	votes := map[string]int{}
+	sets := map[string]DdrmResolverAnswer{}
+	order := []string{}
+	responded := 0
+
+	for _, a := range answers {
+		if a.Err != nil {
+			continue
+		}
+
+		key := string(a.Response) + "\x00" + strings.Join(a.Values, "\x00")
+		if _, seen := votes[key]; !seen {
+			order = append(order, key)
+			sets[key] = a
+		}
+
+		votes[key]++
+		responded++
+	}
+
+	if responded == 0 {
+		agreed.Response = ddrmResponseError
+		if len(answers) > 0 {
+			agreed.Response = answers[0].Response
+		}
+
+		return agreed, false
+	}
+
+	// the first answer seen wins ties, so resolver order in the config is a preference order
+	winner := order[0]
+	for _, key := range order {
+		if votes[key] > votes[winner] {
+			winner = key
+		}
+	}
+
+	switch policy {
+	case ddrmConsensusAny:
+		return sets[order[0]], false
+	case ddrmConsensusMajority:
+		return sets[winner], votes[winner]*2 <= responded
+	default:
+		return sets[winner], len(votes) > 1
+	}
 }
 
 func testDnsClient() {
 	if stateDNSClientTest {
-		dbgp(getRecordData("sommefeldt.com", "MX"))
-		dbgp(getRecordData("sommefeldt.com", "A"))
-		dbgp(getRecordData("sommefeldt.com", "SOA"))
-		dbgp(getRecordData("sommefeldt.com", "TXT"))
+		dbgp(getRecordData(DdrmRecordConfig{FQDN: "sommefeldt.com", Type: ddrmRecordTypeMX}))
+		dbgp(getRecordData(DdrmRecordConfig{FQDN: "sommefeldt.com", Type: ddrmRecordTypeA}))
+		dbgp(getRecordData(DdrmRecordConfig{FQDN: "sommefeldt.com", Type: ddrmRecordTypeSOA}))
+		dbgp(getRecordData(DdrmRecordConfig{FQDN: "sommefeldt.com", Type: ddrmRecordTypeTXT}))
 		os.Exit(ddrmExitAfterDNSClientTest)
 	}
 }
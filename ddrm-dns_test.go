@@ -0,0 +1,50 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestResolverConsensus(t *testing.T) {
+	a := func(resolver string, values ...string) DdrmResolverAnswer {
+		return DdrmResolverAnswer{Resolver: resolver, Values: values, Response: ddrmResponseNoError}
+	}
+	failed := func(resolver string, response DdrmResponse) DdrmResolverAnswer {
+		return DdrmResolverAnswer{Resolver: resolver, Response: response, Err: errors.New("no answer")}
+	}
+	nxdomain := DdrmResolverAnswer{Resolver: "r3", Response: ddrmResponseNXDomain}
+
+	tests := []struct {
+		name     string
+		policy   DdrmConsensusPolicy
+		answers  []DdrmResolverAnswer
+		values   []string
+		response DdrmResponse
+		disagree bool
+	}{
+		{"all agree", ddrmConsensusAll, []DdrmResolverAnswer{a("r1", "1"), a("r2", "1")}, []string{"1"}, ddrmResponseNoError, false},
+		{"all with one different", ddrmConsensusAll, []DdrmResolverAnswer{a("r1", "1"), a("r2", "1"), a("r3", "2")}, []string{"1"}, ddrmResponseNoError, true},
+		{"all with a different response", ddrmConsensusAll, []DdrmResolverAnswer{a("r1", "1"), a("r2", "1"), nxdomain}, []string{"1"}, ddrmResponseNoError, true},
+		{"all ignores errored resolvers", ddrmConsensusAll, []DdrmResolverAnswer{a("r1", "1"), failed("r2", ddrmResponseTimeout)}, []string{"1"}, ddrmResponseNoError, false},
+		{"majority wins", ddrmConsensusMajority, []DdrmResolverAnswer{a("r1", "2"), a("r2", "1"), a("r3", "1")}, []string{"1"}, ddrmResponseNoError, false},
+		{"majority tie goes to the first resolver", ddrmConsensusMajority, []DdrmResolverAnswer{a("r1", "2"), a("r2", "1")}, []string{"2"}, ddrmResponseNoError, true},
+		{"majority without more than half", ddrmConsensusMajority, []DdrmResolverAnswer{a("r1", "1"), a("r2", "2"), a("r3", "3")}, []string{"1"}, ddrmResponseNoError, true},
+		{"majority of those that responded", ddrmConsensusMajority, []DdrmResolverAnswer{failed("r1", ddrmResponseTimeout), failed("r2", ddrmResponseTimeout), a("r3", "1")}, []string{"1"}, ddrmResponseNoError, false},
+		{"any takes the first that responded", ddrmConsensusAny, []DdrmResolverAnswer{failed("r1", ddrmResponseTimeout), a("r2", "2"), a("r3", "1"), a("r4", "1")}, []string{"2"}, ddrmResponseNoError, false},
+		{"nobody responded", ddrmConsensusAll, []DdrmResolverAnswer{failed("r1", ddrmResponseTimeout), failed("r2", ddrmResponseRefused)}, nil, ddrmResponseTimeout, false},
+		{"no resolvers", ddrmConsensusAll, nil, nil, ddrmResponseError, false},
+	}
+
+	for _, test := range tests {
+		agreed, disagree := resolverConsensus(test.policy, test.answers)
+
+		if !slices.Equal(agreed.Values, test.values) || agreed.Response != test.response || disagree != test.disagree {
+			t.Errorf("%s: got %v %s, disagree %v, expected %v %s, disagree %v",
+				test.name, agreed.Values, agreed.Response, disagree, test.values, test.response, test.disagree)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Outcome of validating a record's answer up to a trust anchor
+type DdrmDnssecStatus string
+
+const (
+	ddrmDnssecUnchecked DdrmDnssecStatus = ""
+	ddrmDnssecSecure    DdrmDnssecStatus = "secure"
+	ddrmDnssecBogus     DdrmDnssecStatus = "bogus"
+	ddrmDnssecExpiring  DdrmDnssecStatus = "expiring"
+	ddrmDnssecMismatch  DdrmDnssecStatus = "mismatch"
+)
+
+// The root zone KSK-2017 DS record, used when no trust anchors are configured
+const ddrmDnssecRootAnchor string = ". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"
+
+// How close to expiry an RRSIG can get before we warn, unless configured
+const ddrmDnssecDefaultExpiryWarning time.Duration = 72 * time.Hour
+
+// the configured trust anchors, or the root zone's if there aren't any
+func dnssecTrustAnchors() (anchors []*dns.DS) {
+	configured := appConfig().DnssecTrustAnchors
+
+	if len(configured) == 0 {
+		configured = []string{ddrmDnssecRootAnchor}
+	}
+
+	for _, a := range configured {
+		rr, err := dns.NewRR(a)
+
+		if err != nil {
+			dbgf(ddrmErrorInvalidTrustAnchor, a, err)
+			continue
+		}
+
+		if ds, ok := rr.(*dns.DS); ok {
+			anchors = append(anchors, ds)
+		}
+	}
+
+	return
+}
+
+// check the configured trust anchors are all DS records and the expiry warning is a duration
+func validateDnssecConfig(config DdrmAppConfig) error {
+	for _, a := range config.DnssecTrustAnchors {
+		rr, err := dns.NewRR(a)
+
+		if err != nil {
+			return fmt.Errorf(ddrmErrorInvalidTrustAnchor, a, err)
+		}
+
+		if _, ok := rr.(*dns.DS); !ok {
+			return fmt.Errorf(ddrmErrorTrustAnchorNotDS, a)
+		}
+	}
+
+	if err := validatePositiveDuration(config.DnssecExpiryWarning); err != nil {
+		return fmt.Errorf(ddrmErrorInvalidDuration, "dnssec_expiry_warning", config.DnssecExpiryWarning, err)
+	}
+
+	return nil
+}
+
+func dnssecExpiryWarning() time.Duration {
+	warning, err := time.ParseDuration(appConfig().DnssecExpiryWarning)
+
+	if err != nil {
+		return ddrmDnssecDefaultExpiryWarning
+	}
+
+	return warning
+}
+
+// ask for a name with the DO bit set, and CD set so a validating resolver still hands over bogus data for us to look at
+func dnssecQuery(server string, name string, rrtype uint16) (rrs []dns.RR, sigs []*dns.RRSIG, err error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), rrtype)
+	msg.SetEdns0(4096, true)
+	msg.CheckingDisabled = true
+
+	in, err := exchange(server, msg)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rrs, sigs = dnssecRRset(in, dns.Fqdn(name), rrtype)
+
+	// follow along to a CNAME at the name if that's all there is
+	if len(rrs) == 0 && rrtype != dns.TypeCNAME {
+		rrs, sigs = dnssecRRset(in, dns.Fqdn(name), dns.TypeCNAME)
+	}
+
+	return
+}
+
+// pull a single RRset and the signatures that cover it out of a response
+func dnssecRRset(in *dns.Msg, name string, rrtype uint16) (rrs []dns.RR, sigs []*dns.RRSIG) {
+	for _, rr := range in.Answer {
+		if !strings.EqualFold(rr.Header().Name, name) {
+			continue
+		}
+
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			if sig.TypeCovered == rrtype {
+				sigs = append(sigs, sig)
+			}
+		} else if rr.Header().Rrtype == rrtype {
+			rrs = append(rrs, rr)
+		}
+	}
+
+	return
+}
+
+// check that at least one signature over the RRset is in date and made by one of the keys,
+// returning when the valid signature expires
+func dnssecVerify(rrs []dns.RR, sigs []*dns.RRSIG, keys []*dns.DNSKEY, now time.Time) (expires time.Time, err error) {
+	if len(sigs) == 0 {
+		return expires, fmt.Errorf(ddrmErrorDnssecNoSignatures, dns.TypeToString[rrs[0].Header().Rrtype], rrs[0].Header().Name)
+	}
+
+	err = fmt.Errorf(ddrmErrorDnssecNoValidSignature, dns.TypeToString[rrs[0].Header().Rrtype], rrs[0].Header().Name)
+
+	for _, sig := range sigs {
+		// only the zone the RRset is in, or a parent of it, can sign it (RFC 4035 section 5.3.1)
+		if !dnssecSignerCovers(sig.SignerName, rrs[0].Header().Name) {
+			err = fmt.Errorf(ddrmErrorDnssecSignerOutOfZone, dns.TypeToString[sig.TypeCovered], sig.Header().Name, sig.SignerName)
+			continue
+		}
+
+		if !sig.ValidityPeriod(now) {
+			err = fmt.Errorf(ddrmErrorDnssecSignatureOutOfDate, dns.TypeToString[sig.TypeCovered], sig.Header().Name,
+				time.Unix(int64(sig.Inception), 0).UTC().Format(time.RFC3339),
+				time.Unix(int64(sig.Expiration), 0).UTC().Format(time.RFC3339))
+			continue
+		}
+
+		for _, key := range keys {
+			if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+
+			if sig.Verify(key, rrs) == nil {
+				return time.Unix(int64(sig.Expiration), 0), nil
+			}
+		}
+	}
+
+	return
+}
+
+// whether a signer is the name itself or one of its parents, so could be the zone the name is in
+func dnssecSignerCovers(signer string, name string) bool {
+	return dns.IsSubDomain(dns.Fqdn(signer), dns.Fqdn(name))
+}
+
+// the zone that signed a name's RRset, from the first signature that could have come from it
+func dnssecSigner(name string, sigs []*dns.RRSIG) (signer string, found bool) {
+	for _, sig := range sigs {
+		if dnssecSignerCovers(sig.SignerName, name) {
+			return dns.Fqdn(sig.SignerName), true
+		}
+	}
+
+	return
+}
+
+// fetch a zone's DNSKEY RRset and trust it if one of the keys matches a trusted DS and signed the RRset
+func dnssecTrustedKeys(server string, zone string, ds []*dns.DS, now time.Time) (keys []*dns.DNSKEY, expires time.Time, status DdrmDnssecStatus, err error) {
+	rrs, sigs, err := dnssecQuery(server, zone, dns.TypeDNSKEY)
+
+	if err != nil {
+		return nil, expires, ddrmDnssecUnchecked, err
+	}
+
+	matched := []*dns.DNSKEY{}
+
+	for _, rr := range rrs {
+		key, ok := rr.(*dns.DNSKEY)
+		if !ok {
+			continue
+		}
+
+		keys = append(keys, key)
+
+		for _, d := range ds {
+			if key.KeyTag() != d.KeyTag || key.Algorithm != d.Algorithm {
+				continue
+			}
+
+			if digest := key.ToDS(d.DigestType); digest != nil && strings.EqualFold(digest.Digest, d.Digest) {
+				matched = append(matched, key)
+			}
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, expires, ddrmDnssecMismatch, fmt.Errorf(ddrmErrorDnssecNoMatchingKey, zone)
+	}
+
+	expires, err = dnssecVerify(rrs, sigs, matched, now)
+
+	if err != nil {
+		return nil, expires, ddrmDnssecBogus, err
+	}
+
+	return keys, expires, ddrmDnssecSecure, nil
+}
+
+// walk from the closest trust anchor down to the signer, validating each DS and DNSKEY on the way,
+// and return the signer's keys along with the earliest signature expiry seen
+func dnssecChain(server string, signer string, now time.Time) (keys []*dns.DNSKEY, expires time.Time, status DdrmDnssecStatus, err error) {
+	anchorZone := ""
+	anchors := []*dns.DS{}
+
+	for _, a := range dnssecTrustAnchors() {
+		owner := dns.Fqdn(a.Header().Name)
+
+		if !dns.IsSubDomain(owner, signer) {
+			continue
+		}
+
+		if anchorZone == "" || dns.CountLabel(owner) > dns.CountLabel(anchorZone) {
+			anchorZone = owner
+			anchors = []*dns.DS{}
+		}
+
+		if strings.EqualFold(owner, anchorZone) {
+			anchors = append(anchors, a)
+		}
+	}
+
+	if anchorZone == "" {
+		return nil, expires, ddrmDnssecMismatch, fmt.Errorf(ddrmErrorDnssecNoTrustAnchor, signer)
+	}
+
+	keys, expires, status, err = dnssecTrustedKeys(server, anchorZone, anchors, now)
+
+	if err != nil {
+		return
+	}
+
+	// every name between the anchor and the signer, shortest first, might be a zone cut
+	labels := dns.Split(signer)
+
+	for i := len(labels) - 1; i >= 0; i-- {
+		name := signer[labels[i]:]
+
+		if dns.CountLabel(name) <= dns.CountLabel(anchorZone) {
+			continue
+		}
+
+		dsRRs, dsSigs, err := dnssecQuery(server, name, dns.TypeDS)
+
+		if err != nil {
+			return nil, expires, ddrmDnssecUnchecked, err
+		}
+
+		if len(dsRRs) == 0 || dsRRs[0].Header().Rrtype != dns.TypeDS {
+			if strings.EqualFold(name, signer) {
+				return nil, expires, ddrmDnssecMismatch, fmt.Errorf(ddrmErrorDnssecNoDS, name)
+			}
+
+			// not a zone cut, so the parent's keys still apply
+			continue
+		}
+
+		dsExpires, err := dnssecVerify(dsRRs, dsSigs, keys, now)
+
+		if err != nil {
+			return nil, expires, ddrmDnssecBogus, err
+		}
+
+		ds := []*dns.DS{}
+		for _, rr := range dsRRs {
+			ds = append(ds, rr.(*dns.DS))
+		}
+
+		var keysExpire time.Time
+		keys, keysExpire, status, err = dnssecTrustedKeys(server, name, ds, now)
+
+		if err != nil {
+			return nil, expires, status, err
+		}
+
+		expires = earliest(expires, dsExpires, keysExpire)
+	}
+
+	return keys, expires, ddrmDnssecSecure, nil
+}
+
+// validate a record's answer up to a trust anchor, and warn if any signature on the way expires soon
+func validateDnssec(record DdrmRecordConfig) (status DdrmDnssecStatus, reason string) {
+	server := dnsResolvers()[0]
+	now := time.Now()
+
+	rrs, sigs, err := dnssecQuery(server, record.FQDN, dns.StringToType[string(record.Type)])
+
+	if err != nil {
+		return ddrmDnssecUnchecked, err.Error()
+	}
+
+	if len(rrs) == 0 {
+		return ddrmDnssecUnchecked, fmt.Sprintf(ddrmErrorDnssecNoData, record.FQDN, string(record.Type))
+	}
+
+	if len(sigs) == 0 {
+		return ddrmDnssecBogus, fmt.Sprintf(ddrmErrorDnssecNoSignatures, string(record.Type), record.FQDN)
+	}
+
+	signer, found := dnssecSigner(record.FQDN, sigs)
+
+	if !found {
+		return ddrmDnssecBogus, fmt.Sprintf(ddrmErrorDnssecSignerOutOfZone, string(record.Type), record.FQDN, sigs[0].SignerName)
+	}
+
+	keys, expires, status, err := dnssecChain(server, signer, now)
+
+	if err != nil {
+		return status, err.Error()
+	}
+
+	answerExpires, err := dnssecVerify(rrs, sigs, keys, now)
+
+	if err != nil {
+		return ddrmDnssecBogus, err.Error()
+	}
+
+	expires = earliest(expires, answerExpires)
+
+	if expires.Sub(now) < dnssecExpiryWarning() {
+		return ddrmDnssecExpiring, fmt.Sprintf(ddrmErrorDnssecExpiringSoon, expires.UTC().Format(time.RFC3339))
+	}
+
+	return ddrmDnssecSecure, ""
+}
+
+// the earliest of the non-zero times
+func earliest(times ...time.Time) (first time.Time) {
+	for _, t := range times {
+		if !t.IsZero() && (first.IsZero() || t.Before(first)) {
+			first = t
+		}
+	}
+
+	return
+}
+
+// whether a DNSSEC status is one that someone needs to hear about
+func dnssecAlerting(status DdrmDnssecStatus) bool {
+	return status == ddrmDnssecBogus || status == ddrmDnssecExpiring || status == ddrmDnssecMismatch
+}
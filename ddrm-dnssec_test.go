@@ -0,0 +1,125 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// a zone signing key for a test zone
+func newTestZoneKey(t *testing.T, zone string) (*dns.DNSKEY, crypto.Signer) {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+
+	private, err := key.Generate(256)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, private.(crypto.Signer)
+}
+
+// sign an RRset with a zone's key, valid for a day either side of now
+func signTestRRset(t *testing.T, rrs []dns.RR, key *dns.DNSKEY, private crypto.Signer, now time.Time) *dns.RRSIG {
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrs[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+		Algorithm:  key.Algorithm,
+		SignerName: key.Hdr.Name,
+		KeyTag:     key.KeyTag(),
+		Inception:  uint32(now.Add(-24 * time.Hour).Unix()),
+		Expiration: uint32(now.Add(24 * time.Hour).Unix()),
+	}
+
+	if err := sig.Sign(private, rrs); err != nil {
+		t.Fatal(err)
+	}
+
+	return sig
+}
+
+func testRRset(t *testing.T) []dns.RR {
+	rr, err := dns.NewRR("www.example.com. 300 IN A 192.0.2.1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []dns.RR{rr}
+}
+
+func TestDnssecVerify(t *testing.T) {
+	now := time.Now()
+	rrs := testRRset(t)
+	key, private := newTestZoneKey(t, "example.com.")
+	sig := signTestRRset(t, rrs, key, private, now)
+
+	expires, err := dnssecVerify(rrs, []*dns.RRSIG{sig}, []*dns.DNSKEY{key}, now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expires.Unix() != int64(sig.Expiration) {
+		t.Errorf("expires at %v, expected %v", expires, sig.Expiration)
+	}
+
+	if _, err := dnssecVerify(rrs, []*dns.RRSIG{sig}, []*dns.DNSKEY{key}, now.Add(48*time.Hour)); err == nil {
+		t.Error("expected an expired signature to be refused")
+	}
+}
+
+// a zone can't vouch for a name outside it, however good its signature is
+func TestDnssecVerifyUnrelatedSigner(t *testing.T) {
+	now := time.Now()
+	rrs := testRRset(t)
+	key, private := newTestZoneKey(t, "example.net.")
+	sig := signTestRRset(t, rrs, key, private, now)
+
+	if _, err := dnssecVerify(rrs, []*dns.RRSIG{sig}, []*dns.DNSKEY{key}, now); err == nil {
+		t.Error("expected a signature from an unrelated zone to be refused")
+	}
+
+	if _, found := dnssecSigner("www.example.com", []*dns.RRSIG{sig}); found {
+		t.Error("expected no signer for a signature from an unrelated zone")
+	}
+}
+
+func TestDnssecSigner(t *testing.T) {
+	sigs := []*dns.RRSIG{
+		{SignerName: "evil.example."},
+		{SignerName: "wwwexample.com."},
+		{SignerName: "example.com."},
+	}
+
+	signer, found := dnssecSigner("www.example.com", sigs)
+
+	if !found || signer != "example.com." {
+		t.Errorf("got %q, %v", signer, found)
+	}
+
+	for _, test := range []struct {
+		signer string
+		name   string
+		covers bool
+	}{
+		{"example.com.", "www.example.com.", true},
+		{"www.example.com.", "www.example.com.", true},
+		{".", "www.example.com.", true},
+		{"example.net.", "www.example.com.", false},
+		{"www.example.com.", "example.com.", false},
+	} {
+		if got := dnssecSignerCovers(test.signer, test.name); got != test.covers {
+			t.Errorf("%s signing %s: got %v", test.signer, test.name, got)
+		}
+	}
+}
@@ -17,7 +17,7 @@ func sendTestEmail() {
 	if stateSendTestEmail {
 		mockFetched := []string{"1.1.1.1"}
 		mockCached := []string{"2.2.2.2"}
-		sent := sendEmail("example.com", ddrmRecordTypeA, mockFetched, mockCached)
+		sent := sendEmail("example.com", ddrmRecordTypeA, mockFetched, mockCached, nil, nil)
 		if sent {
 			dbgf(ddrmSuccessSentMail)
 		} else {
@@ -29,21 +29,200 @@ func sendTestEmail() {
 
 // try and send an email report with records
 // it's not defensive and will just return to the caller with nil if sending fails
-func sendEmail(fqdn string, recordType DdrmRecordType, fetched []string, cached []string) (sent bool) {
-	sent = false
+func sendEmail(fqdn string, recordType DdrmRecordType, fetched []string, cached []string, ttls map[string]uint32, resolvers []DdrmResolverAnswer) (sent bool) {
+	return sendChangeEmail(appConfig().EmailSenderName+" has detected a record change.", fqdn, recordType, fetched, cached, ttls, resolvers)
+}
 
-	now := time.Now()
+// try and send an email report about a change that's still waiting to be approved as the new baseline
+func sendUnacknowledgedEmail(fqdn string, recordType DdrmRecordType, fetched []string, cached []string, ttls map[string]uint32, resolvers []DdrmResolverAnswer) (sent bool) {
+	return sendChangeEmail(appConfig().EmailSenderName+" has detected an unacknowledged record change.", fqdn, recordType, fetched, cached, ttls, resolvers, ddrmReportAwaitingApproval)
+}
 
-	hermesMailer := hermes.Hermes{
-		Product: hermes.Product{
-			Name:      ddrmAppConfig.EmailSenderName,
-			Link:      ddrmAppConfig.EmailLink,
-			Logo:      ddrmAppConfig.EmailLogo,
-			Copyright: "Copyright (c) " + now.Format("2006") + " " + ddrmAppConfig.EmailSenderName,
+func sendChangeEmail(intro string, fqdn string, recordType DdrmRecordType, fetched []string, cached []string, ttls map[string]uint32, resolvers []DdrmResolverAnswer, outros ...string) (sent bool) {
+	// prepare a hermes.Entry record for the data table
+	entry := [][]hermes.Entry{
+		{
+			{Key: "FQDN", Value: fqdn},
+			{Key: "Record", Value: string(recordType)},
+			{Key: "Expected", Value: strings.Join(cached, ", ")},
+			{Key: "Currently", Value: strings.Join(withTTLs(fetched, ttls), ", ")},
 		},
 	}
 
-	// prepare a hermes.Entry record for the data table
+	widths := map[string]string{
+		"FQDN":      "15%",
+		"Record":    "15%",
+		"Expected":  "35%",
+		"Currently": "35%",
+	}
+
+	outros = append(outros, soaChangeSummary(recordType, fetched, cached)...)
+	outros = append(outros, answeredBy(resolvers)...)
+
+	return sendEmailReport(intro, entry, widths, outros...)
+}
+
+// describe which server gave which answer, so it's clear where a change was seen
+func answeredBy(resolvers []DdrmResolverAnswer) (lines []string) {
+	if len(resolvers) < 2 {
+		return
+	}
+
+	for _, r := range resolvers {
+		lines = append(lines, "Answered by "+r.Resolver+": "+answered(r))
+	}
+
+	return
+}
+
+// try and send an email report listing what each resolver answered when they didn't agree
+func sendDisagreementEmail(fqdn string, recordType DdrmRecordType, resolvers []DdrmResolverAnswer) (sent bool) {
+	entry := [][]hermes.Entry{}
+
+	for _, r := range resolvers {
+		entry = append(entry, []hermes.Entry{
+			{Key: "FQDN", Value: fqdn},
+			{Key: "Record", Value: string(recordType)},
+			{Key: "Resolver", Value: r.Resolver},
+			{Key: "Answered", Value: answered(r)},
+		})
+	}
+
+	widths := map[string]string{
+		"FQDN":     "15%",
+		"Record":   "15%",
+		"Resolver": "20%",
+		"Answered": "50%",
+	}
+
+	return sendEmailReport(appConfig().EmailSenderName+" has detected that resolvers disagree about a record.", entry, widths)
+}
+
+// try and send an email report explaining why a record's DNSSEC validation is alerting
+func sendDnssecEmail(fqdn string, recordType DdrmRecordType, status DdrmDnssecStatus, reason string) (sent bool) {
+	entry := [][]hermes.Entry{
+		{
+			{Key: "FQDN", Value: fqdn},
+			{Key: "Record", Value: string(recordType)},
+			{Key: "DNSSEC", Value: string(status)},
+			{Key: "Reason", Value: reason},
+		},
+	}
+
+	widths := map[string]string{
+		"FQDN":   "15%",
+		"Record": "15%",
+		"DNSSEC": "15%",
+		"Reason": "55%",
+	}
+
+	return sendEmailReport(appConfig().EmailSenderName+" has detected a DNSSEC problem with a record.", entry, widths)
+}
+
+// try and send an email report about a TTL outside of a record's configured bounds
+func sendTTLEmail(fqdn string, recordType DdrmRecordType, fetched []string, ttls map[string]uint32, reason string) (sent bool) {
+	entry := [][]hermes.Entry{
+		{
+			{Key: "FQDN", Value: fqdn},
+			{Key: "Record", Value: string(recordType)},
+			{Key: "Currently", Value: strings.Join(withTTLs(fetched, ttls), ", ")},
+			{Key: "Reason", Value: reason},
+		},
+	}
+
+	widths := map[string]string{
+		"FQDN":      "15%",
+		"Record":    "15%",
+		"Currently": "35%",
+		"Reason":    "35%",
+	}
+
+	return sendEmailReport(appConfig().EmailSenderName+" has detected a TTL outside of the configured bounds.", entry, widths)
+}
+
+// try and send an email report explaining what's wrong with a zone's SOA serial
+func sendSOAEmail(fqdn string, serial uint32, reasons []string) (sent bool) {
+	entry := [][]hermes.Entry{}
+
+	for _, reason := range reasons {
+		entry = append(entry, []hermes.Entry{
+			{Key: "FQDN", Value: fqdn},
+			{Key: "Serial", Value: fmt.Sprint(serial)},
+			{Key: "Reason", Value: reason},
+		})
+	}
+
+	widths := map[string]string{
+		"FQDN":   "20%",
+		"Serial": "20%",
+		"Reason": "60%",
+	}
+
+	return sendEmailReport(appConfig().EmailSenderName+" has detected a problem with a zone's SOA serial.", entry, widths)
+}
+
+// try and send an email report about a record that has failed to resolve for too many cycles in a row
+func sendFailureEmail(fqdn string, recordType DdrmRecordType, failures int, resolvers []DdrmResolverAnswer) (sent bool) {
+	entry := [][]hermes.Entry{}
+
+	for _, r := range resolvers {
+		entry = append(entry, []hermes.Entry{
+			{Key: "FQDN", Value: fqdn},
+			{Key: "Record", Value: string(recordType)},
+			{Key: "Resolver", Value: r.Resolver},
+			{Key: "Answered", Value: answered(r)},
+		})
+	}
+
+	widths := map[string]string{
+		"FQDN":     "15%",
+		"Record":   "15%",
+		"Resolver": "20%",
+		"Answered": "50%",
+	}
+
+	intro := fmt.Sprintf("%s has failed to resolve a record %d times in a row.", appConfig().EmailSenderName, failures)
+
+	return sendEmailReport(intro, entry, widths)
+}
+
+// what a resolver answered, in words
+func answered(r DdrmResolverAnswer) string {
+	if r.Err != nil {
+		return string(r.Response) + ": " + r.Err.Error()
+	}
+
+	if len(r.Values) == 0 {
+		return string(r.Response)
+	}
+
+	return strings.Join(r.Values, ", ")
+}
+
+// try and send a high severity email report about values a record must never have
+func sendForbiddenEmail(fqdn string, recordType DdrmRecordType, fetched []string, forbidden []string) (sent bool) {
+	entry := [][]hermes.Entry{
+		{
+			{Key: "FQDN", Value: fqdn},
+			{Key: "Record", Value: string(recordType)},
+			{Key: "Currently", Value: strings.Join(fetched, ", ")},
+			{Key: "Forbidden", Value: strings.Join(forbidden, ", ")},
+		},
+	}
+
+	widths := map[string]string{
+		"FQDN":      "15%",
+		"Record":    "15%",
+		"Currently": "35%",
+		"Forbidden": "35%",
+	}
+
+	return sendEmailReportWithSubject(ddrmForbiddenSubjectPrefix+appConfig().EmailSubject,
+		appConfig().EmailSenderName+" has detected a forbidden value in a record.", entry, widths)
+}
+
+// try and send a single email report about a record oscillating between answers, instead of one per change
+func sendFlappingEmail(fqdn string, recordType DdrmRecordType, fetched []string, cached []string, summary []string) (sent bool) {
 	entry := [][]hermes.Entry{
 		{
 			{Key: "FQDN", Value: fqdn},
@@ -53,26 +232,62 @@ func sendEmail(fqdn string, recordType DdrmRecordType, fetched []string, cached
 		},
 	}
 
+	widths := map[string]string{
+		"FQDN":      "15%",
+		"Record":    "15%",
+		"Expected":  "35%",
+		"Currently": "35%",
+	}
+
+	return sendEmailReport(appConfig().EmailSenderName+" has detected a record flapping between answers. Further changes won't be reported until it settles.", entry, widths, summary...)
+}
+
+// build the email from the intro and data table and send it
+func sendEmailReport(intro string, entry [][]hermes.Entry, widths map[string]string, outros ...string) (sent bool) {
+	return sendEmailReportWithSubject(appConfig().EmailSubject, intro, entry, widths, outros...)
+}
+
+func sendEmailReportWithSubject(subject string, intro string, entry [][]hermes.Entry, widths map[string]string, outros ...string) (sent bool) {
+	sent = false
+
+	// followers keep checking records but leave the notifications to the leader
+	if !isLeader() {
+		dbgf(ddrmDebugFollowerNotSending, subject)
+		return
+	}
+
+	defer func() {
+		observeEmail(sent)
+		emailAttempted(sent)
+	}()
+
+	now := time.Now()
+	config := appConfig()
+
+	hermesMailer := hermes.Hermes{
+		Product: hermes.Product{
+			Name:      config.EmailSenderName,
+			Link:      config.EmailLink,
+			Logo:      config.EmailLogo,
+			Copyright: "Copyright (c) " + now.Format("2006") + " " + config.EmailSenderName,
+		},
+	}
+
 	// prepare a hermes.Email object with configured Body, Intros, Outros and the data table for record showing
 	email := hermes.Email{
 		Body: hermes.Body{
-			Name: ddrmAppConfig.EmailToName,
+			Name: config.EmailToName,
 			Intros: []string{
-				ddrmAppConfig.EmailSenderName + " has detected a record change.",
-			},
-			Outros: []string{
-				"The detection was recorded on " + now.Format(time.RFC1123),
-				"Detected by " + fmt.Sprintf(ddrmStartupBanner, BuildVersion, BuildDate, GitRev, BuildUser),
+				intro,
 			},
+			Outros: append(outros,
+				"The detection was recorded on "+now.Format(time.RFC1123),
+				"Detected by "+fmt.Sprintf(ddrmStartupBanner, BuildVersion, BuildDate, GitRev, BuildUser),
+			),
 			Table: hermes.Table{
 				Data: entry,
 				Columns: hermes.Columns{
-					CustomWidth: map[string]string{
-						"FQDN":      "15%",
-						"Record":    "15%",
-						"Expected":  "35%",
-						"Currently": "35%",
-					},
+					CustomWidth: widths,
 				},
 			},
 		},
@@ -92,20 +307,20 @@ func sendEmail(fqdn string, recordType DdrmRecordType, fetched []string, cached
 	dateString := fmt.Sprintf("Date: %s\r\n", now.Format(time.RFC1123))
 
 	to := []string{
-		ddrmAppConfig.EmailTo,
+		config.EmailTo,
 	}
 
 	envelope := []byte(
-		"To: " + ddrmAppConfig.EmailToName + "<" + ddrmAppConfig.EmailTo + ">\r\n" +
-			"From: " + ddrmAppConfig.EmailUserName + "<" + ddrmAppConfig.EmailUser + ">\r\n" +
-			"Subject: " + ddrmAppConfig.EmailSubject + "\r\n" +
+		"To: " + config.EmailToName + "<" + config.EmailTo + ">\r\n" +
+			"From: " + config.EmailUserName + "<" + config.EmailUser + ">\r\n" +
+			"Subject: " + subject + "\r\n" +
 			"MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\r\n" +
 			dateString + "\r\n")
 
 	message := append(envelope, []byte(emailBody)...)
 
-	auth := smtp.PlainAuth("", ddrmAppConfig.EmailUser, ddrmAppConfig.EmailPassword, ddrmAppConfig.EmailServerHostname)
-	err = smtp.SendMail(ddrmAppConfig.EmailServerHostname+":"+ddrmAppConfig.EmailServerPort, auth, ddrmAppConfig.EmailUser, to, message)
+	auth := smtp.PlainAuth("", config.EmailUser, config.EmailPassword, config.EmailServerHostname)
+	err = smtp.SendMail(config.EmailServerHostname+":"+config.EmailServerPort, auth, config.EmailUser, to, message)
 
 	if err != nil {
 		dbg(ddrmErrorSendingMail)
@@ -0,0 +1,89 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// How long oscillations are counted for when a record sets a flap threshold without a window
+const ddrmDefaultFlapWindow time.Duration = time.Hour
+
+// A change in the observed answer
+type DdrmFlapTransition struct {
+	At     time.Time `json:"at"`
+	Values []string  `json:"values"`
+}
+
+// Confirmation and flap detection state for a record, kept in the cache so it survives restarts
+type DdrmFlapState struct {
+	LastObserved  []string             `json:"last_observed"`
+	PendingValues []string             `json:"pending_values"`
+	PendingCount  int                  `json:"pending_count"`
+	Transitions   []DdrmFlapTransition `json:"transitions"`
+	Flapping      bool                 `json:"flapping"`
+}
+
+func flapWindow(record DdrmRecordConfig) time.Duration {
+	window, err := time.ParseDuration(record.FlapWindow)
+
+	if err != nil || window <= 0 {
+		return ddrmDefaultFlapWindow
+	}
+
+	return window
+}
+
+// track a record's observed answer, deciding whether a change from the baseline has been seen for enough
+// cycles in a row to be confirmed, and whether the answer is oscillating too often to report each change
+func trackFlapping(record DdrmRecordConfig, flap *DdrmFlapState, changed bool, fetched []string, now time.Time) (confirmed bool, startedFlapping bool) {
+	// every time the answer differs from the one before counts as a transition, baseline or not
+	if flap.LastObserved != nil && !slices.Equal(flap.LastObserved, fetched) {
+		flap.Transitions = append(flap.Transitions, DdrmFlapTransition{At: now, Values: fetched})
+	}
+
+	flap.LastObserved = fetched
+
+	// forget transitions that have aged out of the window
+	window := flapWindow(record)
+	flap.Transitions = slices.DeleteFunc(flap.Transitions, func(t DdrmFlapTransition) bool {
+		return now.Sub(t.At) > window
+	})
+
+	wasFlapping := flap.Flapping
+	flap.Flapping = record.FlapThreshold > 0 && len(flap.Transitions) >= record.FlapThreshold
+	startedFlapping = flap.Flapping && !wasFlapping
+
+	if !changed {
+		flap.PendingValues = nil
+		flap.PendingCount = 0
+
+		return false, startedFlapping
+	}
+
+	if slices.Equal(flap.PendingValues, fetched) {
+		flap.PendingCount++
+	} else {
+		flap.PendingValues = fetched
+		flap.PendingCount = 1
+	}
+
+	confirmed = flap.PendingCount >= max(record.Confirmations, 1)
+
+	return confirmed, startedFlapping
+}
+
+// describe the oscillations that made a record start flapping
+func flapSummary(record DdrmRecordConfig, flap DdrmFlapState) (lines []string) {
+	lines = append(lines, fmt.Sprintf(ddrmReportFlapSummary, len(flap.Transitions), flapWindow(record).String()))
+
+	for _, t := range flap.Transitions {
+		lines = append(lines, t.At.Format(time.RFC1123)+": "+strings.Join(t.Values, ", "))
+	}
+
+	return
+}
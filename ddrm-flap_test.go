@@ -0,0 +1,127 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// one processing cycle: the answer seen, whether it differs from the baseline, and what should come of it
+type flapStep struct {
+	after     time.Duration
+	values    []string
+	changed   bool
+	confirmed bool
+	started   bool
+	flapping  bool
+}
+
+func TestTrackFlapping(t *testing.T) {
+	a, b, c := []string{"192.0.2.1"}, []string{"192.0.2.2"}, []string{"192.0.2.3"}
+
+	tests := []struct {
+		name   string
+		record DdrmRecordConfig
+		steps  []flapStep
+	}{
+		{
+			name:   "a change is confirmed straight away by default",
+			record: DdrmRecordConfig{},
+			steps: []flapStep{
+				{values: a},
+				{values: b, changed: true, confirmed: true},
+			},
+		},
+		{
+			name:   "a change needs confirming for enough cycles in a row",
+			record: DdrmRecordConfig{Confirmations: 3},
+			steps: []flapStep{
+				{values: a},
+				{values: b, changed: true},
+				{values: b, changed: true},
+				{values: b, changed: true, confirmed: true},
+			},
+		},
+		{
+			name:   "going back to the baseline resets confirmation",
+			record: DdrmRecordConfig{Confirmations: 2},
+			steps: []flapStep{
+				{values: a},
+				{values: b, changed: true},
+				{values: a},
+				{values: b, changed: true},
+				{values: b, changed: true, confirmed: true},
+			},
+		},
+		{
+			name:   "a different change starts confirmation again",
+			record: DdrmRecordConfig{Confirmations: 2},
+			steps: []flapStep{
+				{values: a},
+				{values: b, changed: true},
+				{values: c, changed: true},
+				{values: c, changed: true, confirmed: true},
+			},
+		},
+		{
+			name:   "flapping starts at the threshold and is only reported once",
+			record: DdrmRecordConfig{FlapThreshold: 3, FlapWindow: "1h"},
+			steps: []flapStep{
+				{values: a},
+				{after: time.Minute, values: b, changed: true, confirmed: true},
+				{after: time.Minute, values: a},
+				{after: time.Minute, values: b, changed: true, confirmed: true, started: true, flapping: true},
+				{after: time.Minute, values: a, flapping: true},
+			},
+		},
+		{
+			name:   "flapping stops once transitions age out of the window",
+			record: DdrmRecordConfig{FlapThreshold: 2, FlapWindow: "10m"},
+			steps: []flapStep{
+				{values: a},
+				{after: time.Minute, values: b, changed: true, confirmed: true},
+				{after: time.Minute, values: a, started: true, flapping: true},
+				{after: 9 * time.Minute, values: a, flapping: true},
+				{after: time.Minute, values: a},
+				{after: 5 * time.Minute, values: a},
+			},
+		},
+		{
+			name:   "transitions outside the window don't count towards flapping",
+			record: DdrmRecordConfig{FlapThreshold: 2, FlapWindow: "10m"},
+			steps: []flapStep{
+				{values: a},
+				{after: time.Minute, values: b, changed: true, confirmed: true},
+				{after: 11 * time.Minute, values: a},
+				{after: 11 * time.Minute, values: b, changed: true, confirmed: true},
+			},
+		},
+		{
+			name:   "no threshold, no flapping",
+			record: DdrmRecordConfig{},
+			steps: []flapStep{
+				{values: a},
+				{values: b, changed: true, confirmed: true},
+				{values: a},
+				{values: b, changed: true, confirmed: true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		flap := DdrmFlapState{}
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		for i, step := range test.steps {
+			now = now.Add(step.after)
+			confirmed, started := trackFlapping(test.record, &flap, step.changed, step.values, now)
+
+			if confirmed != step.confirmed || started != step.started || flap.Flapping != step.flapping {
+				t.Errorf("%s, step %d: got confirmed %v, started %v, flapping %v, expected %v, %v, %v",
+					test.name, i, confirmed, started, flap.Flapping, step.confirmed, step.started, step.flapping)
+			}
+		}
+	}
+}
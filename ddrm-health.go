@@ -0,0 +1,168 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// HTTP endpoints for supervisors to check on DDRM
+const (
+	ddrmHttpPathHealthz string = "/healthz"
+	ddrmHttpPathReadyz  string = "/readyz"
+)
+
+// How long the readiness check waits for the cache to answer
+const ddrmReadyCacheTimeout time.Duration = 2 * time.Second
+
+// How many processing intervals can pass without a complete cycle before DDRM isn't ready,
+// when ready_max_cycle_age isn't set
+const ddrmDefaultCycleAgeIntervals = 3
+
+// A single readiness check and how it went
+type DdrmReadyCheck struct {
+	Ok     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// The readiness report served at /readyz
+type DdrmReadiness struct {
+	Ready          bool                      `json:"ready"`
+	LastCycle      time.Time                 `json:"last_cycle"`
+	LastCycleAge   string                    `json:"last_cycle_age"`
+	CacheReachable bool                      `json:"cache_reachable"`
+	LastEmailSent  bool                      `json:"last_email_sent"`
+	EmailFailures  int                       `json:"email_failures"`
+	Checks         map[string]DdrmReadyCheck `json:"checks"`
+}
+
+// When the last complete processing cycle finished, and how the last emails went
+var (
+	healthLock          sync.Mutex
+	healthLastCycle     time.Time
+	healthLastEmailSent = true
+	healthEmailFailures int
+)
+
+func setupHealth() {
+	if _, err := time.ParseDuration(appConfig().ReadyMaxCycleAge); appConfig().ReadyMaxCycleAge != "" && err != nil {
+		dbgf(ddrmErrorInvalidReadyMaxCycleAge, appConfig().ReadyMaxCycleAge, err)
+		os.Exit(ddrmExitDuringConfig)
+	}
+	ddrmHttpMux.HandleFunc(ddrmHttpPathHealthz, handleHealthz)
+	ddrmHttpMux.HandleFunc(ddrmHttpPathReadyz, handleReadyz)
+}
+
+func cycleCompleted(at time.Time) {
+	healthLock.Lock()
+	defer healthLock.Unlock()
+
+	healthLastCycle = at
+}
+
+// keep track of whether emails are being sent, counting failures in a row
+func emailAttempted(sent bool) {
+	healthLock.Lock()
+	defer healthLock.Unlock()
+
+	healthLastEmailSent = sent
+
+	if sent {
+		healthEmailFailures = 0
+	} else {
+		healthEmailFailures++
+	}
+}
+
+// how old the last complete cycle can get before DDRM isn't ready
+func readyMaxCycleAge() time.Duration {
+	if age, err := time.ParseDuration(appConfig().ReadyMaxCycleAge); err == nil && age > 0 {
+		return age
+	}
+
+	return ddrmDefaultCycleAgeIntervals * stateSleep
+}
+
+// the cache is reachable if it's not in use, or if the state store answers
+func cacheReachable() error {
+	if !stateUseCache {
+		return nil
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, ddrmReadyCacheTimeout)
+	defer cancel()
+
+	return ddrmStateStore.Ping(pingCtx)
+}
+
+func readiness(now time.Time) (report DdrmReadiness) {
+	healthLock.Lock()
+	report.LastCycle = healthLastCycle
+	report.LastEmailSent = healthLastEmailSent
+	report.EmailFailures = healthEmailFailures
+	healthLock.Unlock()
+
+	report.Checks = map[string]DdrmReadyCheck{}
+
+	// a cycle should complete every -sleep, so a much older one means processing is stuck
+	cycle := DdrmReadyCheck{Ok: !report.LastCycle.IsZero()}
+	if cycle.Ok {
+		age := now.Sub(report.LastCycle)
+		report.LastCycleAge = age.Round(time.Second).String()
+		cycle.Ok = age <= readyMaxCycleAge()
+		cycle.Detail = report.LastCycleAge + " since the last complete cycle, allowing " + readyMaxCycleAge().String()
+	} else {
+		cycle.Detail = "no processing cycle has completed yet"
+	}
+
+	report.Checks["cycle"] = cycle
+
+	cache := DdrmReadyCheck{Ok: true, Detail: "not in use"}
+	if stateUseCache {
+		cache.Detail = "reachable"
+
+		if err := cacheReachable(); err != nil {
+			cache = DdrmReadyCheck{Ok: false, Detail: err.Error()}
+		}
+	}
+
+	report.CacheReachable = cache.Ok
+	report.Checks["cache"] = cache
+
+	// failing to send email only counts against readiness if ready_max_email_failures asks it to
+	email := DdrmReadyCheck{Ok: true, Detail: "the last email was sent, if there's been one"}
+	if !report.LastEmailSent {
+		email.Detail = "the last email couldn't be sent"
+		email.Ok = appConfig().ReadyMaxEmailFailures <= 0 || report.EmailFailures < appConfig().ReadyMaxEmailFailures
+	}
+
+	report.Checks["email"] = email
+
+	report.Ready = cycle.Ok && cache.Ok && email.Ok
+
+	return
+}
+
+// GET /healthz answers as long as DDRM is running and serving HTTP
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// GET /readyz reports whether processing is keeping up, the cache is reachable and emails are being sent,
+// answering 503 when any of them are failing their thresholds
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := readiness(time.Now())
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, report)
+}
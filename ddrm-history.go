@@ -0,0 +1,123 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How many history entries are kept for each record when history_length isn't set
+const ddrmDefaultHistoryLength int64 = 1000
+
+// The CLI subcommand for printing a record's history
+const ddrmSubcommandHistory string = "history"
+
+// How many history entries the history subcommand and the TUI show by default
+const ddrmHistoryShown int64 = 20
+
+// An observed transition in a record's answer
+type DdrmHistoryEntry struct {
+	At        time.Time    `json:"at"`
+	OldValues []string     `json:"old_values"`
+	NewValues []string     `json:"new_values"`
+	Resolver  string       `json:"resolver"`
+	Response  DdrmResponse `json:"response"`
+}
+
+func historyLength() int64 {
+	if appConfig().HistoryLength > 0 {
+		return appConfig().HistoryLength
+	}
+
+	return ddrmDefaultHistoryLength
+}
+
+// append a history entry when a record's answer is different from the last one that was observed,
+// looking at the newest history entry when there's no in-memory state yet, like after a restart
+func recordHistory(record DdrmRecordConfig, previousValues []string, previousResponse DdrmResponse, answer DdrmRecordAnswer, now time.Time) error {
+	if answer.Disagree || answer.Response == "" {
+		return nil
+	}
+
+	values := slices.Clone(answer.Values)
+	slices.Sort(values)
+
+	if previousResponse == "" {
+		latest, err := getCachedHistory(record.FQDN, record.Type, 1)
+
+		if err != nil {
+			return err
+		}
+
+		if len(latest) == 1 {
+			previousValues, previousResponse = latest[0].NewValues, latest[0].Response
+		}
+	}
+
+	if previousResponse == answer.Response && slices.Equal(previousValues, values) {
+		return nil
+	}
+
+	entry := DdrmHistoryEntry{
+		At:        now,
+		OldValues: previousValues,
+		NewValues: values,
+		Resolver:  answer.Resolver,
+		Response:  answer.Response,
+	}
+
+	return addCachedHistory(record.FQDN, record.Type, entry)
+}
+
+// describe a history entry on a single line
+func (h DdrmHistoryEntry) String() string {
+	return fmt.Sprintf(ddrmReportHistoryEntry, h.At.Format(time.RFC3339), string(h.Response), historyValues(h.OldValues), historyValues(h.NewValues), h.Resolver)
+}
+
+func historyValues(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// history <fqdn> <type> [count] prints a record's transitions, newest first
+func runHistorySubcommand() {
+	fqdn, recordType := flag.Arg(1), DdrmRecordType(flag.Arg(2))
+
+	count := ddrmHistoryShown
+	if n, err := strconv.ParseInt(flag.Arg(3), 10, 64); err == nil && n > 0 {
+		count = n
+	}
+
+	if _, found := recordConfig(fqdn, recordType); !found {
+		fmt.Fprintf(os.Stderr, ddrmErrorUnknownRecord+"\n", fqdn, string(recordType))
+		os.Exit(ddrmExitErrorRunningSubcommand)
+	}
+
+	if !stateUseCache {
+		fmt.Fprintln(os.Stderr, ddrmErrorHistoryNeedsCache)
+		os.Exit(ddrmExitErrorRunningSubcommand)
+	}
+
+	history, err := getCachedHistory(fqdn, recordType, count)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(ddrmExitErrorRunningSubcommand)
+	}
+
+	for _, entry := range history {
+		fmt.Println(entry.String())
+	}
+
+	os.Exit(ddrmExitOK)
+}
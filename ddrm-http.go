@@ -0,0 +1,175 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTP endpoints
+const (
+	ddrmHttpPathApprove string = "/approve"
+)
+
+// How long the HTTP server waits on clients, so slow or idle ones can't hold connections open
+const (
+	ddrmHttpReadHeaderTimeout time.Duration = 5 * time.Second
+	ddrmHttpReadTimeout       time.Duration = 10 * time.Second
+	ddrmHttpWriteTimeout      time.Duration = 30 * time.Second
+	ddrmHttpIdleTimeout       time.Duration = 2 * time.Minute
+)
+
+// the HTTP server's routes, which are only served when http_listen is set
+var ddrmHttpMux = http.NewServeMux()
+
+func setupHttpServer() {
+	if appConfig().HttpListen == "" {
+		return
+	}
+
+	ddrmHttpMux.HandleFunc(ddrmHttpPathApprove, requireApiToken(handleApprove))
+	setupMetrics()
+	setupHealth()
+	setupApi()
+	setupWeb()
+
+	server := &http.Server{
+		Addr:              appConfig().HttpListen,
+		Handler:           ddrmHttpMux,
+		ReadHeaderTimeout: ddrmHttpReadHeaderTimeout,
+		ReadTimeout:       ddrmHttpReadTimeout,
+		WriteTimeout:      ddrmHttpWriteTimeout,
+		IdleTimeout:       ddrmHttpIdleTimeout,
+	}
+
+	// api_tokens are sent with every authenticated request, so they need TLS unless a proxy provides it
+	tlsConfig, err := httpTlsConfig(*appConfig())
+
+	if err != nil {
+		httpServerFailed(err)
+	}
+
+	server.TLSConfig = tlsConfig
+
+	// bind straight away, so an address that can't be used stops DDRM rather than leaving it running without its endpoints
+	listener, err := net.Listen("tcp", server.Addr)
+
+	if err != nil {
+		httpServerFailed(err)
+	}
+
+	go func() {
+		var err error
+
+		if server.TLSConfig != nil {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+
+		if err != nil {
+			dbgf(ddrmErrorHttpServer, err)
+		}
+	}()
+}
+
+// the HTTP server couldn't be started, which is worth stopping for even without -debug
+func httpServerFailed(err error) {
+	dbgf(ddrmErrorHttpServer, err)
+	fmt.Fprintf(os.Stderr, ddrmErrorHttpServer+"\n", err)
+	os.Exit(ddrmExitErrorStartingHttpServer)
+}
+
+// the HTTP server's TLS config when it has a certificate and key, loading them now so a bad pair stops DDRM starting
+func httpTlsConfig(config DdrmAppConfig) (*tls.Config, error) {
+	if config.HttpTlsCertFile == "" && config.HttpTlsKeyFile == "" {
+		return nil, nil
+	}
+
+	if config.HttpTlsCertFile == "" || config.HttpTlsKeyFile == "" {
+		return nil, errors.New(ddrmErrorHttpTlsFiles)
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.HttpTlsCertFile, config.HttpTlsKeyFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// the name of whoever owns the request's bearer token, if it's one of the configured api_tokens
+func apiTokenOwner(r *http.Request) (name string, ok bool) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	if !found || token == "" {
+		return "", false
+	}
+
+	for name, t := range appConfig().ApiTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// only let requests through that carry one of the configured api_tokens, passing along who it belongs to
+func requireApiToken(handler func(w http.ResponseWriter, r *http.Request, name string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, ok := apiTokenOwner(r)
+
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		handler(w, r, name)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// POST /approve with fqdn and type approves the record's current values as its new baseline
+func handleApprove(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	fqdn, recordType := r.FormValue("fqdn"), DdrmRecordType(r.FormValue("type"))
+
+	if _, found := recordConfig(fqdn, recordType); !found {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	// approve what the operator can see, rather than whatever the record answers with right now
+	state := getRecordState(fqdn + ":" + string(recordType))
+	approval, err := approveRecord(fqdn, recordType, state.CurrentValues, name)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, approval)
+}
@@ -0,0 +1,93 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Whether this instance currently holds the leader lease, and how many times it's taken it
+var (
+	stateIsLeader   atomic.Bool
+	stateLeaderTerm atomic.Uint64
+)
+
+// whether leader election is turned on with leader_lease
+func leaderElection() bool {
+	return stateUseCache && appConfig().LeaderLease != ""
+}
+
+func leaderLease() time.Duration {
+	lease, err := time.ParseDuration(appConfig().LeaderLease)
+
+	if err != nil || lease <= 0 {
+		return 0
+	}
+
+	return lease
+}
+
+// the name this instance holds the lease under, defaulting to something unique to the process
+func instanceName() string {
+	if appConfig().InstanceName != "" {
+		return appConfig().InstanceName
+	}
+
+	hostname, _ := os.Hostname()
+
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// whether this instance should send notifications and write the shared state,
+// which is always true unless leader election is turned on
+func isLeader() bool {
+	return !leaderElection() || stateIsLeader.Load()
+}
+
+// check the leader_lease config, refusing to start if it can't be used
+func validateLeaderLease() {
+	if appConfig().LeaderLease != "" && leaderLease() == 0 {
+		dbgf(ddrmErrorInvalidLeaderLease, appConfig().LeaderLease)
+		os.Exit(ddrmExitDuringConfig)
+	}
+}
+
+// try to take or keep hold of the leader lease, which lapses if it isn't renewed in time,
+// so a follower can take over when the leader stops
+func renewLeadership() {
+	if !leaderElection() {
+		return
+	}
+
+	leader, err := ddrmStateStore.AcquireLease(instanceName(), leaderLease())
+
+	if err != nil {
+		dbgf(ddrmErrorLeaderLease, err)
+	}
+
+	if stateIsLeader.Swap(leader) != leader {
+		// a new term tells processRecord to forget which alerts were noted while following
+		if leader {
+			stateLeaderTerm.Add(1)
+		}
+
+		dbgf(ddrmReportLeadership, instanceName(), leadershipRole())
+	}
+}
+
+// describe whether this instance is the leader, for the TUI and logs
+func leadershipRole() string {
+	if !leaderElection() {
+		return ""
+	}
+
+	if stateIsLeader.Load() {
+		return "leader"
+	}
+
+	return "follower"
+}
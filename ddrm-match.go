@@ -0,0 +1,259 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Kinds of expected value, written as a "<kind>:" prefix in expected_values
+type DdrmMatcherKind string
+
+const (
+	ddrmMatchLiteral DdrmMatcherKind = "literal"
+	ddrmMatchRegex   DdrmMatcherKind = "regex"
+	ddrmMatchGlob    DdrmMatcherKind = "glob"
+	ddrmMatchCIDR    DdrmMatcherKind = "cidr"
+	ddrmMatchSuffix  DdrmMatcherKind = "suffix"
+)
+
+// How the fetched values have to relate to the expected values
+type DdrmMatchMode string
+
+const (
+	ddrmMatchExact    DdrmMatchMode = "exact"
+	ddrmMatchSubset   DdrmMatchMode = "subset"
+	ddrmMatchSuperset DdrmMatchMode = "superset"
+)
+
+// An expected value that fetched values can be matched against
+type DdrmMatcher struct {
+	Kind    DdrmMatcherKind
+	Pattern string
+	regex   *regexp.Regexp
+	prefix  netip.Prefix
+}
+
+// parse an expected value, treating anything without a known "<kind>:" prefix as a literal
+// so existing configs keep working, and "literal:" lets a literal start with a kind's prefix
+func parseMatcher(expected string) (matcher DdrmMatcher, err error) {
+	matcher = DdrmMatcher{Kind: ddrmMatchLiteral, Pattern: expected}
+
+	kind, pattern, found := strings.Cut(expected, ":")
+
+	if !found {
+		return
+	}
+
+	switch DdrmMatcherKind(kind) {
+	case ddrmMatchLiteral, ddrmMatchSuffix:
+		matcher = DdrmMatcher{Kind: DdrmMatcherKind(kind), Pattern: pattern}
+	case ddrmMatchRegex:
+		matcher = DdrmMatcher{Kind: ddrmMatchRegex, Pattern: pattern}
+		matcher.regex, err = regexp.Compile(pattern)
+	case ddrmMatchGlob:
+		// * matches any run of characters and ? any single one, anything else is literal
+		glob := regexp.QuoteMeta(pattern)
+		glob = strings.ReplaceAll(glob, `\*`, ".*")
+		glob = strings.ReplaceAll(glob, `\?`, ".")
+
+		matcher = DdrmMatcher{Kind: ddrmMatchGlob, Pattern: pattern}
+		matcher.regex, err = regexp.Compile("^" + glob + "$")
+	case ddrmMatchCIDR:
+		matcher = DdrmMatcher{Kind: ddrmMatchCIDR, Pattern: pattern}
+		matcher.prefix, err = netip.ParsePrefix(pattern)
+	}
+
+	if err != nil {
+		err = fmt.Errorf(ddrmErrorInvalidMatcher, expected, err)
+	}
+
+	return
+}
+
+// Matchers compiled from expected and forbidden values, keyed by the value as it's configured
+var ddrmMatchers sync.Map
+
+// the matcher for an expected value, compiling it the first time it's seen, which is normally
+// while validating the config
+func compiledMatcher(expected string) (DdrmMatcher, error) {
+	if m, found := ddrmMatchers.Load(expected); found {
+		return m.(DdrmMatcher), nil
+	}
+
+	m, err := parseMatcher(expected)
+
+	if err == nil {
+		ddrmMatchers.Store(expected, m)
+	}
+
+	return m, err
+}
+
+func (m DdrmMatcher) Matches(value string) bool {
+	switch m.Kind {
+	case ddrmMatchRegex, ddrmMatchGlob:
+		return m.regex.MatchString(value)
+	case ddrmMatchCIDR:
+		addr, err := netip.ParseAddr(value)
+		return err == nil && m.prefix.Contains(addr)
+	case ddrmMatchSuffix:
+		// hostnames are case insensitive, and the trailing dot depends on -imprecise
+		// and the suffix has to start at a label, so example.com doesn't match evilexample.com
+		v := strings.ToLower(strings.TrimSuffix(value, "."))
+		suffix := strings.ToLower(strings.TrimSuffix(m.Pattern, "."))
+		return v == suffix || strings.HasSuffix(v, "."+strings.TrimPrefix(suffix, "."))
+	}
+
+	return value == m.Pattern
+}
+
+// whether any expected value is a pattern rather than a plain literal
+func hasPatterns(expected []string) bool {
+	for _, e := range expected {
+		if m, err := compiledMatcher(e); err == nil && m.Kind != ddrmMatchLiteral {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expected values that are all literals, without any "literal:" prefixes
+func literalValues(expected []string) (literals []string) {
+	for _, e := range expected {
+		m, _ := compiledMatcher(e)
+		literals = append(literals, m.Pattern)
+	}
+
+	return
+}
+
+func compiledMatchers(expected []string) (matchers []DdrmMatcher) {
+	for _, e := range expected {
+		if m, err := compiledMatcher(e); err == nil {
+			matchers = append(matchers, m)
+		}
+	}
+
+	return
+}
+
+func matchesAny(matchers []DdrmMatcher, value string) bool {
+	for _, m := range matchers {
+		if m.Matches(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// the fetched values that don't match any of the expected values
+func outsideExpected(expected []string, fetched []string) (outside []string) {
+	matchers := compiledMatchers(expected)
+
+	for _, v := range fetched {
+		if !matchesAny(matchers, v) {
+			outside = append(outside, v)
+		}
+	}
+
+	return
+}
+
+// the expected values that none of the fetched values match
+func missingExpected(expected []string, fetched []string) (missing []string) {
+	for _, e := range expected {
+		m, err := compiledMatcher(e)
+
+		if err == nil && !slices.ContainsFunc(fetched, m.Matches) {
+			missing = append(missing, e)
+		}
+	}
+
+	return
+}
+
+// the match mode a record uses, defaulting to exact unless it has patterns to match within
+func recordMatchMode(record DdrmRecordConfig) DdrmMatchMode {
+	if record.Match != "" {
+		return record.Match
+	}
+
+	if hasPatterns(record.ExpectedValues) {
+		return ddrmMatchSubset
+	}
+
+	return ddrmMatchExact
+}
+
+// compare fetched values with expected ones using a match mode, returning 0 if they match
+func compareExpected(mode DdrmMatchMode, expected []string, fetched []string) int {
+	switch mode {
+	case ddrmMatchSubset:
+		if len(outsideExpected(expected, fetched)) > 0 {
+			return 1
+		}
+	case ddrmMatchSuperset:
+		if len(missingExpected(expected, fetched)) > 0 {
+			return -1
+		}
+	default:
+		if !hasPatterns(expected) {
+			literals := literalValues(expected)
+			slices.Sort(literals)
+
+			return slices.Compare(literals, fetched)
+		}
+
+		if len(outsideExpected(expected, fetched)) > 0 || len(missingExpected(expected, fetched)) > 0 {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// the fetched values that match any of the record's forbidden values
+func forbiddenValues(record DdrmRecordConfig, fetched []string) (forbidden []string) {
+	matchers := compiledMatchers(record.ForbiddenValues)
+
+	for _, v := range fetched {
+		if matchesAny(matchers, v) {
+			forbidden = append(forbidden, v)
+		}
+	}
+
+	return
+}
+
+// check a record's match mode is known, that its expected and forbidden values parse,
+// and that CIDR is only used where there are addresses
+func validateMatchers(record DdrmRecordConfig) error {
+	switch record.Match {
+	case "", ddrmMatchExact, ddrmMatchSubset, ddrmMatchSuperset:
+	default:
+		return fmt.Errorf(ddrmErrorUnknownMatchMode, string(record.Match))
+	}
+
+	for _, e := range append(slices.Clone(record.ExpectedValues), record.ForbiddenValues...) {
+		m, err := compiledMatcher(e)
+
+		if err != nil {
+			return err
+		}
+
+		if m.Kind == ddrmMatchCIDR && record.Type != ddrmRecordTypeA && record.Type != ddrmRecordTypeAAAA {
+			return fmt.Errorf(ddrmErrorCIDRNotAddress, e, string(record.Type))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+//go:build client
+// +build client
+
+package main
+
+import "testing"
+
+func TestMatcherMatches(t *testing.T) {
+	tests := []struct {
+		expected string
+		value    string
+		matches  bool
+	}{
+		{"192.0.2.1", "192.0.2.1", true},
+		{"192.0.2.1", "192.0.2.10", false},
+		{"literal:regex:abc", "regex:abc", true},
+		{"literal:regex:abc", "abc", false},
+		{"no-prefix:value", "no-prefix:value", true},
+
+		{"regex:^v=spf1 ", "v=spf1 include:example.com -all", true},
+		{"regex:^v=spf1 ", "v=DMARC1; p=none", false},
+
+		{"glob:*.cdn.example.net.", "edge1.cdn.example.net.", true},
+		{"glob:*.cdn.example.net.", "cdn.example.net.", false},
+		{"glob:edge?.example.net.", "edge1.example.net.", true},
+		{"glob:edge?.example.net.", "edge10.example.net.", false},
+		{"glob:a.b", "axb", false},
+
+		{"cidr:203.0.113.0/24", "203.0.113.7", true},
+		{"cidr:203.0.113.0/24", "203.0.114.7", false},
+		{"cidr:2001:db8::/32", "2001:db8::1", true},
+		{"cidr:203.0.113.0/24", "not an address", false},
+
+		{"suffix:example.com", "www.example.com.", true},
+		{"suffix:example.com", "WWW.Example.COM", true},
+		{"suffix:example.com", "example.com.", true},
+		{"suffix:example.com", "evilexample.com.", false},
+		{"suffix:.example.com", "www.example.com.", true},
+		{"suffix:.example.com", "evilexample.com.", false},
+		{"suffix:example.com.", "example.com.evil.net.", false},
+	}
+
+	for _, test := range tests {
+		m, err := parseMatcher(test.expected)
+
+		if err != nil {
+			t.Errorf("%q: %v", test.expected, err)
+			continue
+		}
+
+		if got := m.Matches(test.value); got != test.matches {
+			t.Errorf("%q matching %q: got %v, expected %v", test.expected, test.value, got, test.matches)
+		}
+	}
+}
+
+func TestParseMatcherInvalid(t *testing.T) {
+	for _, expected := range []string{"regex:(", "cidr:203.0.113.0", "cidr:nonsense/24"} {
+		if _, err := parseMatcher(expected); err == nil {
+			t.Errorf("%q: expected an error", expected)
+		}
+	}
+}
+
+func TestCompareExpected(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     DdrmMatchMode
+		expected []string
+		fetched  []string
+		matches  bool
+	}{
+		{"exact literals", ddrmMatchExact, []string{"192.0.2.1", "192.0.2.2"}, []string{"192.0.2.1", "192.0.2.2"}, true},
+		{"exact literals missing one", ddrmMatchExact, []string{"192.0.2.1", "192.0.2.2"}, []string{"192.0.2.1"}, false},
+		{"exact with literal prefix", ddrmMatchExact, []string{"literal:regex:x"}, []string{"regex:x"}, true},
+		{"exact patterns", ddrmMatchExact, []string{"cidr:192.0.2.0/24"}, []string{"192.0.2.1", "192.0.2.2"}, true},
+		{"subset inside", ddrmMatchSubset, []string{"cidr:192.0.2.0/24", "198.51.100.1"}, []string{"192.0.2.9"}, true},
+		{"subset outside", ddrmMatchSubset, []string{"cidr:192.0.2.0/24"}, []string{"192.0.2.9", "198.51.100.1"}, false},
+		{"superset has all", ddrmMatchSuperset, []string{"192.0.2.1"}, []string{"192.0.2.1", "198.51.100.1"}, true},
+		{"superset missing", ddrmMatchSuperset, []string{"192.0.2.1", "192.0.2.2"}, []string{"192.0.2.1"}, false},
+		{"subset suffix bypass", ddrmMatchSubset, []string{"suffix:example.com"}, []string{"evilexample.com."}, false},
+	}
+
+	for _, test := range tests {
+		if got := compareExpected(test.mode, test.expected, test.fetched) == 0; got != test.matches {
+			t.Errorf("%s: got %v, expected %v", test.name, got, test.matches)
+		}
+	}
+}
+
+func TestForbiddenValues(t *testing.T) {
+	record := DdrmRecordConfig{ForbiddenValues: []string{"cidr:10.0.0.0/8", "suffix:evil.example"}}
+	fetched := []string{"10.1.2.3", "192.0.2.1", "notevil.example.", "www.evil.example."}
+
+	forbidden := forbiddenValues(record, fetched)
+
+	if len(forbidden) != 2 || forbidden[0] != "10.1.2.3" || forbidden[1] != "www.evil.example." {
+		t.Errorf("unexpected forbidden values: %v", forbidden)
+	}
+}
+
+func TestValidateMatchers(t *testing.T) {
+	tests := []struct {
+		record DdrmRecordConfig
+		valid  bool
+	}{
+		{DdrmRecordConfig{Type: ddrmRecordTypeA, ExpectedValues: []string{"cidr:192.0.2.0/24"}}, true},
+		{DdrmRecordConfig{Type: ddrmRecordTypeCNAME, ExpectedValues: []string{"cidr:192.0.2.0/24"}}, false},
+		{DdrmRecordConfig{Type: ddrmRecordTypeA, ForbiddenValues: []string{"regex:("}}, false},
+		{DdrmRecordConfig{Type: ddrmRecordTypeA, Match: "most"}, false},
+	}
+
+	for _, test := range tests {
+		if err := validateMatchers(test.record); (err == nil) != test.valid {
+			t.Errorf("%+v: got %v, expected valid %v", test.record, err, test.valid)
+		}
+	}
+}
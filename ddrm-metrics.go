@@ -0,0 +1,152 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// HTTP endpoint for Prometheus to scrape
+const ddrmHttpPathMetrics string = "/metrics"
+
+// Labels that identify a record in metrics
+var ddrmRecordLabels = []string{"fqdn", "type"}
+
+// Prometheus metrics, registered in their own registry so only DDRM's metrics and the usual Go ones are exposed
+var (
+	ddrmMetrics = prometheus.NewRegistry()
+
+	metricRecordChanged = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ddrm_record_changed",
+		Help: "Whether the record's answer differs from its expected values, 1 if it does.",
+	}, ddrmRecordLabels)
+
+	metricRecordErrored = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ddrm_record_errored",
+		Help: "Whether the record couldn't be resolved in the last cycle, 1 if it couldn't.",
+	}, ddrmRecordLabels)
+
+	metricRecordLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ddrm_record_last_success_timestamp_seconds",
+		Help: "When the record was last resolved successfully, as a Unix timestamp.",
+	}, ddrmRecordLabels)
+
+	metricRecordQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ddrm_record_query_duration_seconds",
+		Help:    "How long it took to ask every resolver about the record.",
+		Buckets: prometheus.DefBuckets,
+	}, ddrmRecordLabels)
+
+	metricRecordResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ddrm_record_responses_total",
+		Help: "How many times the record got each response code, as agreed by the resolvers.",
+	}, append(ddrmRecordLabels, "rcode"))
+
+	metricRecordTTL = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ddrm_record_ttl_seconds",
+		Help: "The lowest TTL observed across the record's values in the last cycle.",
+	}, ddrmRecordLabels)
+
+	metricCycleDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ddrm_processing_cycle_duration_seconds",
+		Help:    "How long it took to process every record.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+
+	metricEmails = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ddrm_emails_total",
+		Help: "How many emails DDRM tried to send, by whether they were sent or failed.",
+	}, []string{"result"})
+
+	metricCacheErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ddrm_cache_errors_total",
+		Help: "How many times reading or writing the cache failed.",
+	})
+)
+
+func init() {
+	ddrmMetrics.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metricRecordChanged,
+		metricRecordErrored,
+		metricRecordLastSuccess,
+		metricRecordQueryDuration,
+		metricRecordResponses,
+		metricRecordTTL,
+		metricCycleDuration,
+		metricEmails,
+		metricCacheErrors,
+	)
+}
+
+func setupMetrics() {
+	ddrmHttpMux.Handle(ddrmHttpPathMetrics, promhttp.HandlerFor(ddrmMetrics, promhttp.HandlerOpts{}))
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// update a record's metrics once it's been processed
+func observeRecord(record DdrmRecordConfig, state DdrmRecordState, answer DdrmRecordAnswer, latency time.Duration) {
+	labels := prometheus.Labels{"fqdn": record.FQDN, "type": string(record.Type)}
+
+	metricRecordChanged.With(labels).Set(boolGauge(state.Changed || state.Unacknowledged))
+	metricRecordErrored.With(labels).Set(boolGauge(state.Errored))
+	metricRecordQueryDuration.With(labels).Observe(latency.Seconds())
+
+	if !state.LastSuccess.IsZero() {
+		metricRecordLastSuccess.With(labels).Set(float64(state.LastSuccess.Unix()))
+	}
+
+	if answer.Response != "" {
+		metricRecordResponses.WithLabelValues(record.FQDN, string(record.Type), string(answer.Response)).Inc()
+	}
+
+	if len(answer.TTLs) > 0 {
+		lowest := ^uint32(0)
+		for _, ttl := range answer.TTLs {
+			lowest = min(lowest, ttl)
+		}
+
+		metricRecordTTL.With(labels).Set(float64(lowest))
+	}
+}
+
+// drop a record's metrics once it's no longer monitored
+func forgetRecordMetrics(fqdn string, recordType DdrmRecordType) {
+	labels := prometheus.Labels{"fqdn": fqdn, "type": string(recordType)}
+
+	metricRecordChanged.Delete(labels)
+	metricRecordErrored.Delete(labels)
+	metricRecordLastSuccess.Delete(labels)
+	metricRecordQueryDuration.Delete(labels)
+	metricRecordResponses.DeletePartialMatch(labels)
+	metricRecordTTL.Delete(labels)
+}
+
+func observeCycle(duration time.Duration) {
+	metricCycleDuration.Observe(duration.Seconds())
+}
+
+func observeEmail(sent bool) {
+	if sent {
+		metricEmails.WithLabelValues("success").Inc()
+	} else {
+		metricEmails.WithLabelValues("failure").Inc()
+	}
+}
+
+func observeCacheError() {
+	metricCacheErrors.Inc()
+}
@@ -5,55 +5,219 @@ package main
 
 import (
 	"fmt"
+	"maps"
+	"reflect"
 	"slices"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Type to store currently fetched record state
 type DdrmRecordState struct {
-	FQDN          string
-	Type          DdrmRecordType
-	CurrentValues []string
-	PriorValues   []string
-	Changed       bool
-	SentEmail     bool
-	Errored       bool
-	Processing    bool
+	FQDN                 string               `json:"fqdn"`
+	Type                 DdrmRecordType       `json:"type"`
+	CurrentValues        []string             `json:"current_values"`
+	PriorValues          []string             `json:"prior_values"`
+	Changed              bool                 `json:"changed"`
+	SentEmail            bool                 `json:"sent_email"`
+	Errored              bool                 `json:"errored"`
+	Processing           bool                 `json:"processing"`
+	Disagree             bool                 `json:"disagree"`
+	Resolvers            []DdrmResolverAnswer `json:"resolvers"`
+	Dnssec               DdrmDnssecStatus     `json:"dnssec"`
+	DnssecReason         string               `json:"dnssec_reason"`
+	TTLs                 map[string]uint32    `json:"ttls"`
+	TTLAlert             bool                 `json:"ttl_alert"`
+	TTLReason            string               `json:"ttl_reason"`
+	Serial               uint32               `json:"serial"`
+	HighestSerial        uint32               `json:"highest_serial"`
+	SerialChangedAt      time.Time            `json:"serial_changed_at"`
+	SerialApprovedAt     time.Time            `json:"serial_approved_at"`
+	SOAAlert             bool                 `json:"soa_alert"`
+	SOAReason            string               `json:"soa_reason"`
+	Response             DdrmResponse         `json:"response"`
+	UnexpectedResponse   bool                 `json:"unexpected_response"`
+	Failures             int                  `json:"failures"`
+	Forbidden            bool                 `json:"forbidden"`
+	PendingChange        bool                 `json:"pending_change"`
+	Flap                 DdrmFlapState        `json:"flap"`
+	Unacknowledged       bool                 `json:"unacknowledged"`
+	CacheError           string               `json:"cache_error"`
+	LastChecked          time.Time            `json:"last_checked"`
+	LastSuccess          time.Time            `json:"last_success"`
+	ApprovedBy           string               `json:"approved_by"`
+	ApprovedAt           time.Time            `json:"approved_at"`
+	LastObservedValues   []string             `json:"last_observed_values"`
+	LastObservedResponse DdrmResponse         `json:"last_observed_response"`
+	LeaderTerm           uint64               `json:"leader_term"`
 }
 
-// current in-memory record states
-var ddrmRecordStates map[string]DdrmRecordState
+// current in-memory record states, shared between the record processing workers and the TUI
+var (
+	ddrmRecordStates     map[string]DdrmRecordState
+	ddrmRecordStatesLock sync.RWMutex
+)
+
+func getRecordState(key string) DdrmRecordState {
+	ddrmRecordStatesLock.RLock()
+	defer ddrmRecordStatesLock.RUnlock()
+
+	return ddrmRecordStates[key]
+}
+
+func setRecordState(key string, state DdrmRecordState) {
+	ddrmRecordStatesLock.Lock()
+	defer ddrmRecordStatesLock.Unlock()
+
+	ddrmRecordStates[key] = state
+}
+
+func deleteRecordState(key string) {
+	ddrmRecordStatesLock.Lock()
+	defer ddrmRecordStatesLock.Unlock()
+
+	delete(ddrmRecordStates, key)
+}
 
-func checkRecordDataForChanges(fqdn string, recordType DdrmRecordType, answer []string) (changed bool, fetched []string, cached []string, compare int) {
+// limits how many records are processed at once, shared by the processing cycle and records checked straight away
+var (
+	ddrmWorkerSlots     chan struct{}
+	ddrmWorkerSlotsOnce sync.Once
+)
+
+// a lock for each record, so that the same record is never processed twice at once
+var ddrmRecordLocks sync.Map
+
+// process a record in one of the -workers slots, once any other check of it has finished
+func checkRecord(record DdrmRecordConfig) {
+	key := record.FQDN + ":" + string(record.Type)
+	lock, _ := ddrmRecordLocks.LoadOrStore(key, &sync.Mutex{})
+
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	ddrmWorkerSlotsOnce.Do(func() { ddrmWorkerSlots = make(chan struct{}, max(stateWorkers, 1)) })
+	ddrmWorkerSlots <- struct{}{}
+	defer func() { <-ddrmWorkerSlots }()
+
+	processRecord(record)
+}
+
+// a copy of every record state that's safe to read while the workers carry on
+func recordStatesSnapshot() map[string]DdrmRecordState {
+	ddrmRecordStatesLock.RLock()
+	defer ddrmRecordStatesLock.RUnlock()
+
+	snapshot := make(map[string]DdrmRecordState, len(ddrmRecordStates))
+	for k, v := range ddrmRecordStates {
+		snapshot[k] = v
+	}
+
+	return snapshot
+}
+
+func checkRecordDataForChanges(fqdn string, recordType DdrmRecordType, answer []string) (changed bool, fetched []string, cached []string, compare int, err error) {
 	changed = false
 
-	cache := getCachedValues(fqdn, recordType)
+	slices.Sort(answer)
+	fetched = answer
 
-	expectedConfigs := make(map[string]DdrmRecordConfig)
+	cache, err := getCachedValues(fqdn, recordType)
 
-	for _, recordConfig := range ddrmRecordConfig {
-		expectedConfigs[recordConfig.FQDN+":"+string(recordConfig.Type)] = recordConfig
+	if err != nil {
+		return
 	}
 
-	if len(cache) == 0 {
+	record, _ := recordConfig(fqdn, recordType)
+	mode := recordMatchMode(record)
+
+	// patterns and partial matches describe everything that's allowed rather than a single answer,
+	// so only exact matching of literals follows along with the cache
+	if len(cache) == 0 || !followsCache(record) {
 		// fall back to the startup config
-		cache = expectedConfigs[fqdn+":"+string(recordType)].ExpectedValues
-	}
+		cache = slices.Clone(record.ExpectedValues)
 
-	// sort both and compare
-	slices.Sort(cache)
-	slices.Sort(answer)
+		if followsCache(record) {
+			cache = normaliseSOAValues(record.Type, cache)
+		}
+
+		slices.Sort(cache)
 
-	compare = slices.Compare(cache, answer)
+		compare = compareExpected(mode, cache, answer)
+	} else {
+		// cached values are answers we've fetched before, so they're compared as they are
+		// rather than as patterns
+		cache = normaliseSOAValues(record.Type, cache)
+		slices.Sort(cache)
+
+		compare = slices.Compare(cache, answer)
+	}
 	changed = compare != 0
-	fetched = answer
 	cached = cache
 
-	_ = setCachedValues(fqdn, recordType, answer)
+	return
+}
+
+// check the highest TTL each value was seen with against the record's optional bounds, describing the first one outside them
+// recursive resolvers count TTLs down as their cached copies age, so min_ttl only applies to authoritative answers
+func checkTTLBounds(record DdrmRecordConfig, answer DdrmRecordAnswer) (reason string) {
+	ttls := maps.Clone(answer.TTLs)
+
+	for _, resolver := range answer.Resolvers {
+		for v, ttl := range resolver.TTLs {
+			if _, agreed := ttls[v]; agreed {
+				ttls[v] = max(ttls[v], ttl)
+			}
+		}
+	}
+
+	values := make([]string, 0, len(ttls))
+	for v := range ttls {
+		values = append(values, v)
+	}
+
+	slices.Sort(values)
+
+	for _, v := range values {
+		ttl := ttls[v]
+
+		if record.Authoritative && record.MinTTL > 0 && ttl < record.MinTTL {
+			return fmt.Sprintf(ddrmReportTTLBelowMinimum, v, ttl, record.MinTTL)
+		}
+
+		if record.MaxTTL > 0 && ttl > record.MaxTTL {
+			return fmt.Sprintf(ddrmReportTTLAboveMaximum, v, ttl, record.MaxTTL)
+		}
+	}
 
 	return
 }
 
+// the values a resolver answered with, or the kind of response if there weren't any
+func responseValues(answer DdrmRecordAnswer) []string {
+	if len(answer.Values) > 0 {
+		return answer.Values
+	}
+
+	return []string{string(answer.Response)}
+}
+
+// show each value with the TTL it was observed with, if there is one
+func withTTLs(values []string, ttls map[string]uint32) []string {
+	shown := make([]string, 0, len(values))
+
+	for _, v := range values {
+		if ttl, ok := ttls[v]; ok {
+			v = fmt.Sprintf("%s (%d)", v, ttl)
+		}
+
+		shown = append(shown, v)
+	}
+
+	return shown
+}
+
 func stringProcessor(s string) string {
 	if stateExpand {
 		s = strings.ReplaceAll(s, "\t", strings.Repeat(" ", stateTabsToSpaces))
@@ -67,53 +231,344 @@ func stringProcessor(s string) string {
 }
 
 func processRecords() {
-	for _, record := range ddrmRecordConfig {
+	start := time.Now()
+	defer func() {
+		observeCycle(time.Since(start))
+		cycleCompleted(time.Now())
+	}()
+
+	// records can be changed while they're being processed, so work through the ones there were at the start
+	configs := recordConfigs()
+
+	for _, record := range configs {
 		// indicate processing state for everything
-		state := ddrmRecordStates[record.FQDN+":"+string(record.Type)]
+		key := record.FQDN + ":" + string(record.Type)
+		state := getRecordState(key)
 		state.Processing = true
 		state.SentEmail = false
 		state.Errored = false
 		state.Changed = false
-		ddrmRecordStates[record.FQDN+":"+string(record.Type)] = state
+		setRecordState(key, state)
 	}
 
-	for _, record := range ddrmRecordConfig {
-		data := getRecordData(record.FQDN, record.Type)
+	// hand the records out to a bounded pool of workers
+	records := make(chan DdrmRecordConfig)
 
-		if len(data) == 0 {
-			dbgf(ddrmErrorUnableToFetchRecord, record.FQDN, string(record.Type))
+	var wg sync.WaitGroup
 
-			// set the error state but don't remove the the current + expected so they can be shown in the UI
-			state := ddrmRecordStates[record.FQDN+":"+string(record.Type)]
-			state.Errored = true
-			state.Processing = false
-			ddrmRecordStates[record.FQDN+":"+string(record.Type)] = state
-		} else {
-			changed, fetched, cached, compare := checkRecordDataForChanges(record.FQDN, record.Type, data)
+	for i := 0; i < max(stateWorkers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for record := range records {
+				checkRecord(record)
+			}
+		}()
+	}
+
+	for _, record := range configs {
+		records <- record
+	}
+
+	close(records)
+	wg.Wait()
+}
+
+func processRecord(record DdrmRecordConfig) {
+	start := time.Now()
+	answer := getRecordData(record)
+	latency := time.Since(start)
+	data := answer.Values
+
+	key := record.FQDN + ":" + string(record.Type)
+	state := getRecordState(key)
+
+	// cache problems are shown for as long as they last, so start each cycle afresh
+	state.CacheError = ""
+
+	// followers note problems without being able to email about them, so after taking over
+	// forget what was noted, and report anything that's still going on
+	newTerm := state.LeaderTerm != stateLeaderTerm.Load()
+
+	if newTerm {
+		forgetAlerts(&state)
+		state.LeaderTerm = stateLeaderTerm.Load()
+	}
+
+	// the leader keeps a timeline of every transition in the answer
+	if isLeader() {
+		cacheFailed(record, &state, recordHistory(record, state.LastObservedValues, state.LastObservedResponse, answer, time.Now()))
+	}
+
+	if !answer.Disagree {
+		state.LastObservedValues = slices.Clone(answer.Values)
+		slices.Sort(state.LastObservedValues)
+		state.LastObservedResponse = answer.Response
+	}
+
+	// approvals can come from the CLI or another instance, so the state store has the last word on them
+	approval, err := getCachedApproval(record.FQDN, record.Type)
+	cacheFailed(record, &state, err)
+
+	if approval.At.After(state.ApprovedAt) {
+		state.ApprovedBy = approval.By
+		state.ApprovedAt = approval.At
+	}
+
+	state.FQDN = record.FQDN
+	state.Type = record.Type
+	state.Resolvers = answer.Resolvers
+	state.Response = answer.Response
+
+	if record.Dnssec {
+		status, reason := validateDnssec(record)
+
+		if dnssecAlerting(status) {
+			dbgf(ddrmErrorDnssecAlert, string(status), record.FQDN, string(record.Type), reason)
+
+			// like disagreements, only tell someone when the status changes
+			if status != state.Dnssec {
+				state.SentEmail = sendDnssecEmail(record.FQDN, record.Type, status, reason)
+			}
+		}
+
+		state.Dnssec = status
+		state.DnssecReason = reason
+	}
+
+	if answer.Disagree {
+		dbgf(ddrmErrorResolversDisagree, record.FQDN, string(record.Type))
+
+		// only tell someone when the resolvers start disagreeing, not on every cycle that they still do
+		if !state.Disagree {
+			state.SentEmail = sendDisagreementEmail(record.FQDN, record.Type, answer.Resolvers)
+		}
+
+		// there's no agreed answer to compare, so leave the current + expected alone for the UI
+		state.Disagree = true
+		state.Processing = false
+
+		// a forbidden value is worth knowing about even when only some of the resolvers return it
+		var seen []string
+		for _, resolver := range answer.Resolvers {
+			for _, v := range resolver.Values {
+				if !slices.Contains(seen, v) {
+					seen = append(seen, v)
+				}
+			}
+		}
+
+		slices.Sort(seen)
+		checkForbidden(record, &state, seen)
+	} else if record.ExpectResponse != "" && answer.Response == record.ExpectResponse {
+		// the name is answering the way we were told it should, like NXDOMAIN for a decommissioned record
+		state.CurrentValues = []string{string(answer.Response)}
+		state.PriorValues = []string{string(record.ExpectResponse)}
+		state.UnexpectedResponse = false
+		state.Disagree = false
+		state.Processing = false
+	} else if record.ExpectResponse != "" && answer.Values != nil {
+		// the name answered, but not the way we were told it should
+		fetched := responseValues(answer)
+		expected := []string{string(record.ExpectResponse)}
+
+		dbgf(ddrmErrorUnexpectedResponse, record.FQDN, string(record.Type), string(answer.Response), string(record.ExpectResponse))
+
+		if !state.UnexpectedResponse {
+			state.SentEmail = sendEmail(record.FQDN, record.Type, fetched, expected, answer.TTLs, answer.Resolvers)
+		}
+
+		state.Changed = true
+		state.CurrentValues = fetched
+		state.PriorValues = expected
+		state.TTLs = answer.TTLs
+		state.UnexpectedResponse = true
+		state.Disagree = false
+		state.Processing = false
+
+		// a name that shouldn't answer at all answering with a forbidden value is worse still
+		values := slices.Clone(answer.Values)
+		slices.Sort(values)
+		checkForbidden(record, &state, values)
+	} else if len(data) == 0 {
+		dbgf(ddrmErrorUnableToFetchRecord, record.FQDN, string(record.Type))
+
+		// set the error state but don't remove the the current + expected so they can be shown in the UI
+		state.Disagree = false
+		state.Errored = true
+		state.Failures++
+		state.Processing = false
+
+		// only tell someone once the failure has persisted for as long as the record allows
+		if record.AlertAfterFailures > 0 && (state.Failures == record.AlertAfterFailures || newTerm && state.Failures > record.AlertAfterFailures) {
+			state.SentEmail = sendFailureEmail(record.FQDN, record.Type, state.Failures, answer.Resolvers)
+		}
+	} else {
+		changed, fetched, cached, compare, err := checkRecordDataForChanges(record.FQDN, record.Type, data)
+
+		if err != nil {
+			// without the baseline there's nothing to compare with, and falling back to the expected
+			// values would report changes that aren't real, so show the cache problem instead
+			cacheFailed(record, &state, err)
 
-			// update the running state
-			state := ddrmRecordStates[record.FQDN+":"+string(record.Type)]
-			state.Changed = changed
 			state.CurrentValues = fetched
-			state.PriorValues = cached
+			state.TTLs = answer.TTLs
 			state.Errored = false
-			state.FQDN = record.FQDN
-			state.Type = record.Type
+			state.Disagree = false
 			state.Processing = false
+		} else {
+			followChanges(record, &state, answer, changed, fetched, cached, compare)
+		}
+
+		checkForbidden(record, &state, fetched)
+
+		reason := checkTTLBounds(record, answer)
+
+		if reason != "" {
+			dbgf(ddrmErrorTTLOutOfBounds, record.FQDN, string(record.Type), reason)
 
-			if stateLogRecordProcessing {
-				dbg("changed = " + fmt.Sprint(changed))
-				dbg("compare = " + fmt.Sprint(compare))
-				dbg("fetched = " + fmt.Sprint(fetched))
-				dbg("cached  = " + fmt.Sprint(cached))
-				dbg("data    = " + fmt.Sprint(data))
+			// only tell someone when a TTL goes out of bounds, not on every cycle that it stays there
+			if !state.TTLAlert {
+				state.SentEmail = sendTTLEmail(record.FQDN, record.Type, fetched, answer.TTLs, reason)
 			}
-			if changed {
-				state.SentEmail = sendEmail(record.FQDN, record.Type, fetched, cached)
+		}
+
+		state.TTLAlert = reason != ""
+		state.TTLReason = reason
+	}
+
+	if record.Type == ddrmRecordTypeSOA && len(data) > 0 {
+		reasons := checkSOASerial(record, &state, answer, approval, time.Now())
+		reason := strings.Join(reasons, "; ")
+
+		if reason != "" {
+			dbgf(ddrmErrorSOASerial, record.FQDN, reason)
+
+			// tell someone when the problem with the serial changes, not on every cycle it persists
+			if reason != state.SOAReason {
+				state.SentEmail = sendSOAEmail(record.FQDN, state.Serial, reasons)
 			}
+		}
+
+		state.SOAAlert = reason != ""
+		state.SOAReason = reason
+	}
+
+	if !state.Errored {
+		state.Failures = 0
+	}
+
+	state.LastChecked = start
+
+	if !state.Errored && !state.Disagree {
+		state.LastSuccess = start
+	}
+
+	// the record might have been removed or changed while it was being checked
+	if current, found := recordConfig(record.FQDN, record.Type); !found || !reflect.DeepEqual(current, record) {
+		return
+	}
+
+	observeRecord(record, state, answer, latency)
+
+	setRecordState(key, state)
+	dbg("")
+}
+
+// forget which problems have already been alerted about, so they're alerted about again if they're still there
+func forgetAlerts(state *DdrmRecordState) {
+	state.Disagree = false
+	state.UnexpectedResponse = false
+	state.Forbidden = false
+	state.TTLAlert = false
+	state.SOAReason = ""
+	state.Dnssec = ddrmDnssecUnchecked
+
+	// pick the flapping state up from the cache, where the previous leader left it
+	state.Flap = DdrmFlapState{}
+}
+
+// alert when the record returns any of its forbidden values, whatever else is going on with it
+func checkForbidden(record DdrmRecordConfig, state *DdrmRecordState, fetched []string) {
+	forbidden := forbiddenValues(record, fetched)
+
+	if len(forbidden) > 0 {
+		dbgf(ddrmErrorForbiddenValues, record.FQDN, string(record.Type), forbidden)
 
-			ddrmRecordStates[record.FQDN+":"+string(record.Type)] = state
+		// only tell someone when forbidden values appear, not on every cycle they're still there
+		if !state.Forbidden {
+			state.SentEmail = sendForbiddenEmail(record.FQDN, record.Type, fetched, forbidden)
 		}
-		dbg("")
+	}
+
+	state.Forbidden = len(forbidden) > 0
+}
+
+// keep a cache failure in the record's state so it can be seen, rather than silently carrying on
+func cacheFailed(record DdrmRecordConfig, state *DdrmRecordState, err error) {
+	if err == nil {
+		return
+	}
+
+	dbgf(ddrmErrorCache, record.FQDN, string(record.Type), err)
+	state.CacheError = err.Error()
+	observeCacheError()
+}
+
+// follow along with a change from the record's baseline once it's confirmed, alerting about it
+func followChanges(record DdrmRecordConfig, state *DdrmRecordState, answer DdrmRecordAnswer, changed bool, fetched []string, cached []string, compare int) {
+	data := answer.Values
+
+	// pick up where we left off if there's confirmation and flapping state in the cache
+	if state.Flap.LastObserved == nil {
+		flap, err := getCachedFlapState(record.FQDN, record.Type)
+		state.Flap = flap
+		cacheFailed(record, state, err)
+	}
+
+	confirmed, startedFlapping := trackFlapping(record, &state.Flap, changed, fetched, time.Now())
+
+	// followers leave the shared state to the leader, so a change one of them saw first isn't
+	// cached as the baseline before the leader has had a chance to report it
+	if isLeader() {
+		cacheFailed(record, state, setCachedFlapState(record.FQDN, record.Type, state.Flap))
+	}
+
+	// only follow along with a change once it's confirmed and the record has settled down,
+	// and when approval is required leave the baseline alone until someone approves the change
+	reportable := changed && confirmed && !state.Flap.Flapping
+	unacknowledged := reportable && stateRequireApproval && followsCache(record)
+
+	if isLeader() && (!changed || reportable && !unacknowledged) {
+		cacheFailed(record, state, setCachedValues(record.FQDN, record.Type, fetched))
+	}
+
+	// update the running state
+	state.Changed = changed && confirmed
+	state.PendingChange = changed && !confirmed
+	state.Unacknowledged = unacknowledged
+	state.CurrentValues = fetched
+	state.PriorValues = cached
+	state.TTLs = answer.TTLs
+	state.Errored = false
+	state.Disagree = false
+	state.Processing = false
+
+	if stateLogRecordProcessing {
+		dbg("changed = " + fmt.Sprint(changed))
+		dbg("compare = " + fmt.Sprint(compare))
+		dbg("fetched = " + fmt.Sprint(fetched))
+		dbg("cached  = " + fmt.Sprint(cached))
+		dbg("data    = " + fmt.Sprint(data))
+	}
+	if startedFlapping {
+		dbgf(ddrmErrorRecordFlapping, record.FQDN, string(record.Type), len(state.Flap.Transitions))
+		state.SentEmail = sendFlappingEmail(record.FQDN, record.Type, fetched, cached, flapSummary(record, state.Flap))
+	} else if unacknowledged {
+		// keep telling someone every cycle until the change is approved
+		dbgf(ddrmErrorUnacknowledgedChange, record.FQDN, string(record.Type), fetched)
+		state.SentEmail = sendUnacknowledgedEmail(record.FQDN, record.Type, fetched, cached, answer.TTLs, answer.Resolvers)
+	} else if reportable {
+		state.SentEmail = sendEmail(record.FQDN, record.Type, fetched, cached, answer.TTLs, answer.Resolvers)
 	}
 }
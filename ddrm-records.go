@@ -0,0 +1,274 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// a copy of the record configs that's safe to read while they're being changed
+func recordConfigs() []DdrmRecordConfig {
+	ddrmRecordConfigLock.RLock()
+	defer ddrmRecordConfigLock.RUnlock()
+
+	return slices.Clone(ddrmRecordConfig)
+}
+
+// check a record is one we'd be able to interpret
+func validateRecordConfig(record DdrmRecordConfig) error {
+	if record.FQDN == "" {
+		return errors.New(ddrmErrorRecordNoFQDN)
+	}
+
+	if !slices.Contains(ddrmRecordTypes, record.Type) {
+		return fmt.Errorf(ddrmErrorUnknownRecordType, string(record.Type), record.FQDN)
+	}
+
+	if err := validateMatchers(record); err != nil {
+		return fmt.Errorf(ddrmErrorInvalidExpectedValues, record.FQDN, string(record.Type), err)
+	}
+
+	// resolvers' TTLs count down, so only authoritative answers can be held to a minimum
+	if record.MinTTL > 0 && !record.Authoritative {
+		return fmt.Errorf(ddrmErrorMinTTLNeedsAuthoritative, record.FQDN, string(record.Type))
+	}
+
+	switch record.Consensus {
+	case "", ddrmConsensusAll, ddrmConsensusMajority, ddrmConsensusAny:
+	default:
+		return fmt.Errorf(ddrmErrorUnknownConsensus, string(record.Consensus), record.FQDN, string(record.Type))
+	}
+
+	if err := validatePositiveDuration(record.FlapWindow); err != nil {
+		return fmt.Errorf(ddrmErrorInvalidDuration, "flap_window", record.FlapWindow, err)
+	}
+
+	if err := validatePositiveDuration(record.SerialStaleAfter); err != nil {
+		return fmt.Errorf(ddrmErrorInvalidDuration, "serial_stale_after", record.SerialStaleAfter, err)
+	}
+
+	if record.ExpectResponse != "" && record.ExpectResponse != ddrmResponseNXDomain && record.ExpectResponse != ddrmResponseNoData {
+		return fmt.Errorf(ddrmErrorUnknownExpectedResponse, string(record.ExpectResponse), record.FQDN)
+	}
+
+	return nil
+}
+
+// check an optional duration parses and is longer than zero
+func validatePositiveDuration(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil {
+		return err
+	}
+
+	if duration <= 0 {
+		return errors.New(ddrmErrorDurationNotPositive)
+	}
+
+	return nil
+}
+
+// check every record, and that none of them are monitored twice, since they'd share their state
+func validateRecordSet(records []DdrmRecordConfig) error {
+	seen := map[string]bool{}
+
+	for _, record := range records {
+		if err := validateRecordConfig(record); err != nil {
+			return err
+		}
+
+		key := record.FQDN + ":" + string(record.Type)
+
+		if seen[key] {
+			return fmt.Errorf(ddrmErrorDuplicateRecord, record.FQDN, string(record.Type))
+		}
+
+		seen[key] = true
+	}
+
+	return nil
+}
+
+// write the records to the records config file, replacing it with a rename so that
+// a crash part way through can't leave a truncated file behind
+func saveRecordsConfig(records []DdrmRecordConfig) error {
+	path, err := filepath.EvalSymlinks(stateRecordsConfigFilePath)
+
+	if err != nil {
+		return err
+	}
+
+	stat, err := os.Stat(path)
+
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.MarshalIndent(records, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(append(encoded, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	// keep the file's permissions, which are normally 0400
+	if err := file.Chmod(stat.Mode().Perm()); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// apply a change to the record configs, only keeping it once the records file has been saved
+func changeRecordConfigs(change func(records []DdrmRecordConfig) ([]DdrmRecordConfig, error)) error {
+	// don't let a reload swap the records out from under the change
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	ddrmRecordConfigLock.Lock()
+	defer ddrmRecordConfigLock.Unlock()
+
+	records, err := change(slices.Clone(ddrmRecordConfig))
+
+	if err != nil {
+		return err
+	}
+
+	if err := validateRecordSet(records); err != nil {
+		return err
+	}
+
+	if err := saveRecordsConfig(records); err != nil {
+		dbgf(ddrmErrorSavingRecords, stateRecordsConfigFilePath, err)
+		return fmt.Errorf(ddrmErrorSavingRecords, stateRecordsConfigFilePath, err)
+	}
+
+	// the file watcher shouldn't reload the change we've just made
+	reloadFileVersions[stateRecordsConfigFilePath] = configFileVersion(stateRecordsConfigFilePath)
+
+	ddrmRecordConfig = records
+
+	return nil
+}
+
+// start checking a new or changed record straight away, rather than waiting for the next cycle,
+// as soon as a worker is free and nothing else is checking it
+func checkRecordNow(record DdrmRecordConfig) {
+	key := record.FQDN + ":" + string(record.Type)
+	state := getRecordState(key)
+	state.FQDN, state.Type, state.Processing = record.FQDN, record.Type, true
+	setRecordState(key, state)
+
+	go checkRecord(record)
+}
+
+// stop showing and exporting a record that's no longer monitored
+func forgetRecord(fqdn string, recordType DdrmRecordType) {
+	deleteRecordState(fqdn + ":" + string(recordType))
+	forgetRecordMetrics(fqdn, recordType)
+}
+
+// start monitoring a new record
+func addRecord(record DdrmRecordConfig, by string) error {
+	err := changeRecordConfigs(func(records []DdrmRecordConfig) ([]DdrmRecordConfig, error) {
+		return append(records, record), nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	dbgf(ddrmReportRecordAdded, record.FQDN, string(record.Type), by)
+	checkRecordNow(record)
+
+	return nil
+}
+
+// replace a record's config, which can change which record it is
+func updateRecord(fqdn string, recordType DdrmRecordType, record DdrmRecordConfig, by string) error {
+	err := changeRecordConfigs(func(records []DdrmRecordConfig) ([]DdrmRecordConfig, error) {
+		i := slices.IndexFunc(records, func(r DdrmRecordConfig) bool {
+			return r.FQDN == fqdn && r.Type == recordType
+		})
+
+		if i < 0 {
+			return nil, fmt.Errorf(ddrmErrorUnknownRecord, fqdn, string(recordType))
+		}
+
+		records[i] = record
+
+		return records, nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	dbgf(ddrmReportRecordUpdated, fqdn, string(recordType), by)
+
+	if record.FQDN != fqdn || record.Type != recordType {
+		forgetRecord(fqdn, recordType)
+	}
+
+	checkRecordNow(record)
+
+	return nil
+}
+
+// stop monitoring a record, leaving anything cached about it to expire
+func removeRecord(fqdn string, recordType DdrmRecordType, by string) error {
+	err := changeRecordConfigs(func(records []DdrmRecordConfig) ([]DdrmRecordConfig, error) {
+		remaining := slices.DeleteFunc(records, func(r DdrmRecordConfig) bool {
+			return r.FQDN == fqdn && r.Type == recordType
+		})
+
+		if len(remaining) == len(records) {
+			return nil, fmt.Errorf(ddrmErrorUnknownRecord, fqdn, string(recordType))
+		}
+
+		return remaining, nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	dbgf(ddrmReportRecordRemoved, fqdn, string(recordType), by)
+	forgetRecord(fqdn, recordType)
+
+	return nil
+}
@@ -5,30 +5,212 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// Ways of connecting to Redis that can be chosen with redis_mode
+const (
+	ddrmRedisModeStandalone string = "standalone"
+	ddrmRedisModeSentinel   string = "sentinel"
+	ddrmRedisModeCluster    string = "cluster"
+)
+
+// How long the startup connectivity check waits for Redis to answer
+const ddrmRedisPingTimeout time.Duration = 5 * time.Second
+
+// The parts of the app config that the Redis client is built from
+type DdrmRedisSettings struct {
+	Mode             string
+	Servers          []string
+	Username         string
+	Password         string
+	Database         int
+	SentinelMaster   string
+	SentinelUsername string
+	SentinelPassword string
+	TLS              bool
+	TLSCaFile        string
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSServerName    string
+}
+
+// A Redis client and the settings it was built from. When the settings change it's retired,
+// which waits for anything still using it before closing it
+type DdrmRedisClient struct {
+	client   redis.UniversalClient
+	settings DdrmRedisSettings
+	users    sync.RWMutex
+	retired  bool
+}
+
 // Redis runtime context and database objects
 var (
 	ctx = context.Background()
-	// We reinitialise this client if a startup config is present
-	rdb = redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "",
-		DB:       0,
-	})
+	// The client in use, which is swapped for a new one when the Redis settings change
+	ddrmRedis atomic.Pointer[DdrmRedisClient]
+	// Why a client couldn't be built from the latest settings
+	rdbError error
 )
 
+// the Redis connection settings in the app config, with redis_server standing in for redis_servers
+func redisSettings(config DdrmAppConfig) DdrmRedisSettings {
+	settings := DdrmRedisSettings{
+		Mode:             config.RedisMode,
+		Servers:          config.RedisServers,
+		Username:         config.RedisUsername,
+		Password:         config.RedisPassword,
+		Database:         config.RedisDatabase,
+		SentinelMaster:   config.RedisSentinelMaster,
+		SentinelUsername: config.RedisSentinelUsername,
+		SentinelPassword: config.RedisSentinelPassword,
+		TLS:              config.RedisTls,
+		TLSCaFile:        config.RedisTlsCaFile,
+		TLSCertFile:      config.RedisTlsCertFile,
+		TLSKeyFile:       config.RedisTlsKeyFile,
+		TLSServerName:    config.RedisTlsServerName,
+	}
+
+	if settings.Mode == "" {
+		settings.Mode = ddrmRedisModeStandalone
+	}
+
+	if len(settings.Servers) == 0 {
+		settings.Servers = []string{config.RedisServer}
+	}
+
+	return settings
+}
+
+// TLS config for connecting to Redis, verifying it against a CA bundle and presenting a client certificate if configured
+func redisTLSConfig(settings DdrmRedisSettings) (*tls.Config, error) {
+	if !settings.TLS {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName: settings.TLSServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if settings.TLSCaFile != "" {
+		pem, err := os.ReadFile(settings.TLSCaFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.RootCAs = x509.NewCertPool()
+
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf(ddrmErrorNoCertificatesInBundle, settings.TLSCaFile)
+		}
+	}
+
+	if settings.TLSCertFile != "" || settings.TLSKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(settings.TLSCertFile, settings.TLSKeyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// build a Redis client for a standalone server, a Sentinel-managed failover group, or a cluster
+func newRedisClient(settings DdrmRedisSettings) (redis.UniversalClient, error) {
+	tlsConfig, err := redisTLSConfig(settings)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch settings.Mode {
+	case ddrmRedisModeStandalone:
+		return redis.NewClient(&redis.Options{
+			Addr:      settings.Servers[0],
+			Username:  settings.Username,
+			Password:  settings.Password,
+			DB:        settings.Database,
+			TLSConfig: tlsConfig,
+		}), nil
+	case ddrmRedisModeSentinel:
+		if settings.SentinelMaster == "" {
+			return nil, errors.New(ddrmErrorRedisNoSentinelMaster)
+		}
+
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       settings.SentinelMaster,
+			SentinelAddrs:    settings.Servers,
+			SentinelUsername: settings.SentinelUsername,
+			SentinelPassword: settings.SentinelPassword,
+			Username:         settings.Username,
+			Password:         settings.Password,
+			DB:               settings.Database,
+			TLSConfig:        tlsConfig,
+		}), nil
+	case ddrmRedisModeCluster:
+		// clusters only have database 0
+		if settings.Database != 0 {
+			return nil, errors.New(ddrmErrorRedisClusterDatabase)
+		}
+
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     settings.Servers,
+			Username:  settings.Username,
+			Password:  settings.Password,
+			TLSConfig: tlsConfig,
+		}), nil
+	}
+
+	return nil, fmt.Errorf(ddrmErrorUnknownRedisMode, settings.Mode)
+}
+
+// whether the Redis client in use was built from different settings
+func redisSettingsChanged(settings DdrmRedisSettings) bool {
+	current := ddrmRedis.Load()
+
+	return current == nil || !reflect.DeepEqual(settings, current.settings)
+}
+
 func reinitRedis() (reinitialised bool) {
 	reinitialised = false
 
-	if ddrmAppConfig.RedisServer != rdb.Options().Addr {
-		rdb = redis.NewClient(&redis.Options{
-			Addr:     ddrmAppConfig.RedisServer,
-			Password: ddrmAppConfig.RedisPassword,
-			DB:       ddrmAppConfig.RedisDatabase,
-		})
+	settings := redisSettings(*appConfig())
+
+	if redisSettingsChanged(settings) {
+		client, err := newRedisClient(settings)
+
+		// only complain when Redis is actually used, which checkRedisConnection knows about
+		rdbError = err
+
+		if err != nil {
+			dbgf(ddrmErrorRedisConfig, err)
+			return
+		}
+
+		// anything still using the old client carries on with it until it's done
+		if previous := ddrmRedis.Swap(&DdrmRedisClient{client: client, settings: settings}); previous != nil {
+			go previous.retire()
+		}
+
+		// a new connection might be to a different Redis, so win the lease again before leading
+		stateIsLeader.Store(false)
 
 		reinitialised = true
 	}
@@ -36,57 +218,267 @@ func reinitRedis() (reinitialised bool) {
 	return
 }
 
-func cacheKey(fqdn string, recordType DdrmRecordType) string {
-	return ddrmAppConfig.RedisKeyPrefix + ":" + fqdn + ":" + string(recordType)
-}
+// close a client once nothing is using it any more
+func (c *DdrmRedisClient) retire() {
+	c.users.Lock()
+	defer c.users.Unlock()
 
-// check Redis for current cached data
-func getCachedValues(fqdn string, recordType DdrmRecordType) (answer []string) {
-	dbgf(ddrmDebugTryingCache, fqdn, string(recordType))
+	c.retired = true
+	_ = c.client.Close()
+}
 
-	answer = []string{}
+// run f with the Redis client in use, which can't be closed until f returns
+func withRedis(f func(client redis.UniversalClient) error) error {
+	for {
+		current := ddrmRedis.Load()
 
-	if stateUseRedis {
+		if current == nil {
+			return errors.New(ddrmErrorRedisNoClient)
+		}
 
-		cachedKey := cacheKey(fqdn, recordType)
-		members, err := rdb.SMembers(ctx, cachedKey).Result()
+		current.users.RLock()
 
-		if err != nil {
-			return answer
+		// a client that was retired while we waited has been replaced, so use its replacement
+		if !current.retired {
+			defer current.users.RUnlock()
+			return f(current.client)
 		}
 
-		answer = members
+		current.users.RUnlock()
+	}
+}
+
+// make sure Redis is reachable and accepts our credentials before relying on it,
+// rather than quietly falling back to the startup config on every cycle
+func checkRedisConnection() {
+	if rdbError != nil {
+		fmt.Fprintf(os.Stderr, ddrmErrorRedisConfig+"\n", rdbError)
+		os.Exit(ddrmExitDuringConfig)
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, ddrmRedisPingTimeout)
+	defer cancel()
+
+	settings := ddrmRedis.Load().settings
+	err := withRedis(func(client redis.UniversalClient) error {
+		return client.Ping(pingCtx).Err()
+	})
+
+	if err != nil {
+		dbgf(ddrmErrorRedisUnreachable, strings.Join(settings.Servers, ", "), err)
+		fmt.Fprintf(os.Stderr, ddrmErrorRedisUnreachable+"\n", strings.Join(settings.Servers, ", "), err)
+		os.Exit(ddrmExitErrorConnectingToRedis)
+	}
+
+	dbgf(ddrmReportRedisConnected, settings.Mode, strings.Join(settings.Servers, ", "))
+}
+
+// The state store that keeps everything in Redis, using whichever client is in use
+type redisStateStore struct{}
+
+// Extend the lease if we already hold it, otherwise take it if nobody else does
+var redisLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+func leaderCacheKey() string {
+	return appConfig().RedisKeyPrefix + ":leader"
+}
+
+func flapCacheKey(fqdn string, recordType DdrmRecordType) string {
+	return cacheKey(fqdn, recordType) + ":flap"
+}
+
+func approvalsCacheKey(fqdn string, recordType DdrmRecordType) string {
+	return cacheKey(fqdn, recordType) + ":approvals"
+}
+
+func historyCacheKey(fqdn string, recordType DdrmRecordType) string {
+	return cacheKey(fqdn, recordType) + ":history"
+}
+
+// values are kept as sets
+func (redisStateStore) GetValues(fqdn string, recordType DdrmRecordType) (values []string, err error) {
+	err = withRedis(func(client redis.UniversalClient) (err error) {
+		values, err = client.SMembers(ctx, cacheKey(fqdn, recordType)).Result()
 		return
+	})
+
+	return
+}
+
+// replace the set in a MULTI/EXEC transaction, so a crash part way through can't leave
+// a partial set behind that later looks like a real change
+func (redisStateStore) SetValues(fqdn string, recordType DdrmRecordType, values []string) error {
+	cachedKey := cacheKey(fqdn, recordType)
+
+	members := make([]interface{}, len(values))
+	for i, v := range values {
+		members[i] = v
 	}
 
-	dbgf(ddrmDebugNoCache, fqdn, string(recordType))
+	return withRedis(func(client redis.UniversalClient) error {
+		_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, cachedKey)
+
+			if len(members) > 0 {
+				pipe.SAdd(ctx, cachedKey, members...)
+			}
+
+			if expiry := cacheExpiry(); expiry > 0 {
+				pipe.Expire(ctx, cachedKey, expiry)
+			}
+
+			return nil
+		})
+
+		return err
+	})
+}
+
+// confirmation and flapping state is stored as JSON
+func (redisStateStore) GetFlapState(fqdn string, recordType DdrmRecordType) (flap DdrmFlapState, err error) {
+	var cached []byte
+
+	err = withRedis(func(client redis.UniversalClient) (err error) {
+		cached, err = client.Get(ctx, flapCacheKey(fqdn, recordType)).Bytes()
+		return
+	})
+
+	// records that have never been seen changing have nothing cached yet
+	if errors.Is(err, redis.Nil) {
+		return flap, nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(cached, &flap)
 
 	return
 }
 
-// save values in Redis as sets
-func setCachedValues(fqdn string, recordType DdrmRecordType, answer []string) (success bool) {
-	success = false
+func (redisStateStore) SetFlapState(fqdn string, recordType DdrmRecordType, flap DdrmFlapState) error {
+	encoded, err := json.Marshal(flap)
 
-	if stateUseRedis {
-		cachedKey := cacheKey(fqdn, recordType)
+	if err != nil {
+		return err
+	}
 
-		// delete the key so we can reuse it
-		err := rdb.Del(ctx, cachedKey).Err()
+	return withRedis(func(client redis.UniversalClient) error {
+		return client.Set(ctx, flapCacheKey(fqdn, recordType), encoded, cacheExpiry()).Err()
+	})
+}
 
-		if err != nil {
-			return
+// approvals are kept in a list, newest first
+func (redisStateStore) AddApproval(approval DdrmApproval) error {
+	encoded, err := json.Marshal(approval)
+
+	if err != nil {
+		return err
+	}
+
+	return withRedis(func(client redis.UniversalClient) error {
+		return client.LPush(ctx, approvalsCacheKey(approval.FQDN, approval.Type), encoded).Err()
+	})
+}
+
+func (redisStateStore) LatestApproval(fqdn string, recordType DdrmRecordType) (approval DdrmApproval, err error) {
+	var cached []byte
+
+	err = withRedis(func(client redis.UniversalClient) (err error) {
+		cached, err = client.LIndex(ctx, approvalsCacheKey(fqdn, recordType), 0).Bytes()
+		return
+	})
+
+	// records that have never been approved have nothing cached yet
+	if errors.Is(err, redis.Nil) {
+		return approval, nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(cached, &approval)
+
+	return
+}
+
+func (redisStateStore) Ping(ctx context.Context) error {
+	return withRedis(func(client redis.UniversalClient) error {
+		return client.Ping(ctx).Err()
+	})
+}
+
+// the leader lease is a key holding the leader's name, which expires unless the leader renews it
+func (redisStateStore) AcquireLease(holder string, lease time.Duration) (held bool, err error) {
+	err = withRedis(func(client redis.UniversalClient) error {
+		result, err := redisLeaseScript.Run(ctx, client, []string{leaderCacheKey()}, holder, lease.Milliseconds()).Int()
+		held = result == 1
+
+		return err
+	})
+
+	return
+}
+
+// history is kept in a stream, trimming the oldest entries past history_length
+func (redisStateStore) AddHistory(fqdn string, recordType DdrmRecordType, entry DdrmHistoryEntry) error {
+	oldValues, _ := json.Marshal(entry.OldValues)
+	newValues, _ := json.Marshal(entry.NewValues)
+
+	return withRedis(func(client redis.UniversalClient) error {
+		return client.XAdd(ctx, &redis.XAddArgs{
+			Stream: historyCacheKey(fqdn, recordType),
+			MaxLen: historyLength(),
+			Approx: true,
+			Values: map[string]interface{}{
+				"at":       entry.At.Format(time.RFC3339Nano),
+				"old":      string(oldValues),
+				"new":      string(newValues),
+				"resolver": entry.Resolver,
+				"rcode":    string(entry.Response),
+			},
+		}).Err()
+	})
+}
+
+func (redisStateStore) History(fqdn string, recordType DdrmRecordType, count int64) (history []DdrmHistoryEntry, err error) {
+	var messages []redis.XMessage
+
+	err = withRedis(func(client redis.UniversalClient) (err error) {
+		messages, err = client.XRevRangeN(ctx, historyCacheKey(fqdn, recordType), "+", "-", count).Result()
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	for _, m := range messages {
+		field := func(name string) string {
+			s, _ := m.Values[name].(string)
+			return s
 		}
 
-		// add each answer one at a time because SAdd appears to be bugged
-		for _, a := range answer {
-			err = rdb.SAdd(ctx, cachedKey, a).Err()
-			if err != nil {
-				return
-			}
+		entry := DdrmHistoryEntry{
+			Resolver: field("resolver"),
+			Response: DdrmResponse(field("rcode")),
 		}
 
-		success = true
+		entry.At, _ = time.Parse(time.RFC3339Nano, field("at"))
+		_ = json.Unmarshal([]byte(field("old")), &entry.OldValues)
+		_ = json.Unmarshal([]byte(field("new")), &entry.NewValues)
+
+		history = append(history, entry)
 	}
 
 	return
@@ -0,0 +1,210 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// When each config file was last changed, as far as the file watcher knows
+type DdrmConfigFileVersion struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// Only one reload happens at a time, and the file watcher remembers which versions of the config files it's seen
+var (
+	reloadLock         sync.Mutex
+	reloadFileVersions = map[string]DdrmConfigFileVersion{}
+)
+
+// reload the config on SIGHUP, and note the config files as they are now, so the watcher
+// only reloads when they change
+func setupReload() {
+	for _, path := range []string{stateConfigFilePath, stateRecordsConfigFilePath} {
+		reloadFileVersions[path] = configFileVersion(path)
+	}
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	go func() {
+		for range hangups {
+			dbgf(ddrmReportReloading, "SIGHUP")
+			reloadConfig()
+		}
+	}()
+}
+
+func configFileVersion(path string) DdrmConfigFileVersion {
+	stat, err := os.Stat(path)
+
+	if err != nil {
+		return DdrmConfigFileVersion{}
+	}
+
+	return DdrmConfigFileVersion{ModTime: stat.ModTime(), Size: stat.Size()}
+}
+
+// reload the config if either of the config files has changed since we last looked
+func watchConfigFiles() {
+	reloadLock.Lock()
+	changed := false
+
+	for _, path := range []string{stateConfigFilePath, stateRecordsConfigFilePath} {
+		if version := configFileVersion(path); version != reloadFileVersions[path] {
+			reloadFileVersions[path] = version
+			changed = true
+		}
+	}
+
+	reloadLock.Unlock()
+
+	if changed {
+		dbgf(ddrmReportReloading, "a config file changing")
+		reloadConfig()
+	}
+}
+
+// check the parts of the app config that DDRM would otherwise refuse to start with
+func validateAppConfig(config DdrmAppConfig) error {
+	durations := map[string]string{
+		"cache_expiry":        config.CacheExpiry,
+		"leader_lease":        config.LeaderLease,
+		"ready_max_cycle_age": config.ReadyMaxCycleAge,
+	}
+
+	for name, value := range durations {
+		if _, err := time.ParseDuration(value); value != "" && err != nil {
+			return fmt.Errorf(ddrmErrorInvalidDuration, name, value, err)
+		}
+	}
+
+	// make sure changed Redis settings work before dropping the connection that does
+	if settings := redisSettings(config); usingRedis() && redisSettingsChanged(settings) {
+		client, err := newRedisClient(settings)
+
+		if err != nil {
+			return err
+		}
+
+		defer client.Close()
+
+		pingCtx, cancel := context.WithTimeout(ctx, ddrmRedisPingTimeout)
+		defer cancel()
+
+		if err := client.Ping(pingCtx).Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keep the settings that are only used while starting up, warning that they need a restart to change
+func keepStartupSettings(config *DdrmAppConfig) {
+	current := appConfig()
+	startupSettings := map[string][2]*string{
+		"http_listen":        {&config.HttpListen, &current.HttpListen},
+		"http_tls_cert_file": {&config.HttpTlsCertFile, &current.HttpTlsCertFile},
+		"http_tls_key_file":  {&config.HttpTlsKeyFile, &current.HttpTlsKeyFile},
+		"state_store":        {&config.StateStore, &current.StateStore},
+		"state_file":         {&config.StateFile, &current.StateFile},
+		"leader_lease":       {&config.LeaderLease, &current.LeaderLease},
+		"instance_name":      {&config.InstanceName, &current.InstanceName},
+	}
+
+	for name, setting := range startupSettings {
+		if *setting[0] != *setting[1] {
+			dbgf(ddrmReportReloadNeedsRestart, name)
+			*setting[0] = *setting[1]
+		}
+	}
+}
+
+// read both config files again and swap them in if they're valid, keeping the state of
+// every record that hasn't changed
+func reloadConfig() {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	appConfig, err := loadAppConfig(stateConfigFilePath)
+
+	if err == nil {
+		err = validateAppConfig(appConfig)
+	}
+
+	if err != nil {
+		dbgf(ddrmErrorReloadingConfig, err)
+		return
+	}
+
+	records, err := loadRecordsConfig(stateRecordsConfigFilePath)
+
+	if err != nil {
+		dbgf(ddrmErrorReloadingConfig, err)
+		return
+	}
+
+	// records being processed carry on with whichever config they started with
+	keepStartupSettings(&appConfig)
+	ddrmAppConfig.Store(&appConfig)
+
+	if usingRedis() {
+		reinitRedis()
+	}
+
+	ddrmRecordConfigLock.Lock()
+	previous := ddrmRecordConfig
+	ddrmRecordConfig = records
+	ddrmRecordConfigLock.Unlock()
+
+	// work out which records were added, changed or removed
+	previousRecords := map[string]DdrmRecordConfig{}
+	for _, record := range previous {
+		previousRecords[record.FQDN+":"+string(record.Type)] = record
+	}
+
+	var added, changed []DdrmRecordConfig
+
+	for _, record := range records {
+		key := record.FQDN + ":" + string(record.Type)
+		old, found := previousRecords[key]
+
+		if !found {
+			added = append(added, record)
+		} else if !reflect.DeepEqual(old, record) {
+			changed = append(changed, record)
+		}
+
+		delete(previousRecords, key)
+	}
+
+	for _, record := range previousRecords {
+		forgetRecord(record.FQDN, record.Type)
+	}
+
+	// a changed record's old state describes checks against its old config, so it starts again
+	for _, record := range changed {
+		deleteRecordState(record.FQDN + ":" + string(record.Type))
+		checkRecordNow(record)
+	}
+
+	for _, record := range added {
+		checkRecordNow(record)
+	}
+
+	for _, path := range []string{stateConfigFilePath, stateRecordsConfigFilePath} {
+		reloadFileVersions[path] = configFileVersion(path)
+	}
+
+	dbgf(ddrmReportReloaded, len(added), len(changed), len(previousRecords))
+}
@@ -0,0 +1,202 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The fields of an SOA record's RDATA
+type DdrmSOA struct {
+	Mname   string
+	Rname   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+}
+
+// parse an SOA value, which is its RDATA: mname rname serial refresh retry expire minimum. Values cached
+// and configured before SOA fields were understood are the whole record, which ends with the same fields
+func parseSOA(value string) (soa DdrmSOA, ok bool) {
+	fields := strings.Fields(value)
+
+	if len(fields) < 7 {
+		return soa, false
+	}
+
+	fields = fields[len(fields)-7:]
+
+	numbers := make([]uint32, 5)
+
+	for i, f := range fields[2:] {
+		n, err := strconv.ParseUint(f, 10, 32)
+
+		if err != nil {
+			return soa, false
+		}
+
+		numbers[i] = uint32(n)
+	}
+
+	soa = DdrmSOA{
+		Mname:   fields[0],
+		Rname:   fields[1],
+		Serial:  numbers[0],
+		Refresh: numbers[1],
+		Retry:   numbers[2],
+		Expire:  numbers[3],
+		Minimum: numbers[4],
+	}
+
+	return soa, true
+}
+
+// the SOA's RDATA, in the same form as rdata gives for a *dns.SOA
+func (soa DdrmSOA) String() string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d", soa.Mname, soa.Rname, soa.Serial, soa.Refresh, soa.Retry, soa.Expire, soa.Minimum)
+}
+
+// rewrite SOA values given as the whole record as their RDATA, so ones cached or configured before SOA
+// was compared on its RDATA still match, without the remaining TTL that resolvers count down
+func normaliseSOAValues(recordType DdrmRecordType, values []string) []string {
+	if recordType != ddrmRecordTypeSOA {
+		return values
+	}
+
+	normalised := make([]string, 0, len(values))
+
+	for _, v := range values {
+		if soa, ok := parseSOA(v); ok {
+			v = soa.String()
+		}
+
+		normalised = append(normalised, v)
+	}
+
+	return normalised
+}
+
+// whether serial a comes before serial b using RFC 1982 serial number arithmetic
+func serialBefore(a uint32, b uint32) bool {
+	return a != b && int32(a-b) < 0
+}
+
+// describe each field that differs between two SOA records
+func soaFieldChanges(before DdrmSOA, after DdrmSOA) (changes []string) {
+	fields := []struct {
+		name   string
+		before string
+		after  string
+	}{
+		{"mname", before.Mname, after.Mname},
+		{"rname", before.Rname, after.Rname},
+		{"serial", fmt.Sprint(before.Serial), fmt.Sprint(after.Serial)},
+		{"refresh", fmt.Sprint(before.Refresh), fmt.Sprint(after.Refresh)},
+		{"retry", fmt.Sprint(before.Retry), fmt.Sprint(after.Retry)},
+		{"expire", fmt.Sprint(before.Expire), fmt.Sprint(after.Expire)},
+		{"minimum", fmt.Sprint(before.Minimum), fmt.Sprint(after.Minimum)},
+	}
+
+	for _, f := range fields {
+		if f.before != f.after {
+			changes = append(changes, fmt.Sprintf(ddrmReportSOAFieldChanged, f.name, f.before, f.after))
+		}
+	}
+
+	return
+}
+
+// describe the field changes between the expected and fetched SOA, if both are single parseable records
+func soaChangeSummary(recordType DdrmRecordType, fetched []string, cached []string) []string {
+	if recordType != ddrmRecordTypeSOA || len(fetched) != 1 || len(cached) != 1 {
+		return nil
+	}
+
+	after, okAfter := parseSOA(fetched[0])
+	before, okBefore := parseSOA(cached[0])
+
+	if !okAfter || !okBefore {
+		return nil
+	}
+
+	return soaFieldChanges(before, after)
+}
+
+// track the serial for an SOA record and describe anything wrong with it: a serial that went
+// backwards, one that hasn't moved for longer than the record allows, or servers that disagree.
+// approval is the record's newest approval from the state store.
+func checkSOASerial(record DdrmRecordConfig, state *DdrmRecordState, answer DdrmRecordAnswer, approval DdrmApproval, now time.Time) (reasons []string) {
+	if len(answer.Values) != 1 {
+		return
+	}
+
+	soa, ok := parseSOA(answer.Values[0])
+
+	if !ok {
+		return
+	}
+
+	highest, seen := state.HighestSerial, !state.SerialChangedAt.IsZero()
+
+	// before we've observed anything, the expected or cached value is the best previous serial we have
+	if !seen && len(state.PriorValues) == 1 {
+		if prior, ok := parseSOA(state.PriorValues[0]); ok {
+			highest, seen = prior.Serial, true
+		}
+	}
+
+	// an approved serial is the one later serials are held to from then on, even if it went backwards
+	if approval.At.After(state.SerialApprovedAt) && len(approval.Values) == 1 {
+		if approved, ok := parseSOA(approval.Values[0]); ok {
+			highest, seen = approved.Serial, true
+		}
+
+		state.SerialApprovedAt = approval.At
+	}
+
+	// a serial that went backwards stays a problem until it passes the highest one seen again,
+	// or an operator approves it
+	if seen && serialBefore(soa.Serial, highest) {
+		reasons = append(reasons, fmt.Sprintf(ddrmReportSOASerialRegressed, highest, soa.Serial))
+	} else {
+		state.HighestSerial = soa.Serial
+	}
+
+	if state.SerialChangedAt.IsZero() || soa.Serial != state.Serial {
+		state.Serial = soa.Serial
+		state.SerialChangedAt = now
+	}
+
+	if staleAfter, err := time.ParseDuration(record.SerialStaleAfter); err == nil && staleAfter > 0 {
+		if unchanged := now.Sub(state.SerialChangedAt); unchanged > staleAfter {
+			reasons = append(reasons, fmt.Sprintf(ddrmReportSOASerialStale, soa.Serial, unchanged.Round(time.Second).String()))
+		}
+	}
+
+	// every server should be handing out the same serial
+	serials := []string{}
+	distinct := map[uint32]bool{}
+
+	for _, r := range answer.Resolvers {
+		if r.Err != nil || len(r.Values) != 1 {
+			continue
+		}
+
+		if other, ok := parseSOA(r.Values[0]); ok {
+			serials = append(serials, fmt.Sprintf("%s: %d", r.Resolver, other.Serial))
+			distinct[other.Serial] = true
+		}
+	}
+
+	if len(distinct) > 1 {
+		reasons = append(reasons, fmt.Sprintf(ddrmReportSOASerialMismatch, strings.Join(serials, ", ")))
+	}
+
+	return
+}
@@ -0,0 +1,176 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const testSOA = "ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 3600"
+
+func TestParseSOA(t *testing.T) {
+	for _, value := range []string{
+		testSOA,
+		"example.com.\t3600\tIN\tSOA\t" + testSOA,
+	} {
+		soa, ok := parseSOA(value)
+
+		if !ok || soa.Serial != 2024010101 || soa.Mname != "ns1.example.com." || soa.Minimum != 3600 {
+			t.Errorf("%q: got %+v, %v", value, soa, ok)
+		}
+
+		if soa.String() != testSOA {
+			t.Errorf("%q: RDATA is %q", value, soa.String())
+		}
+	}
+
+	for _, value := range []string{"", "ns1.example.com. hostmaster.example.com. 1 2 3", "a b c d e f g"} {
+		if _, ok := parseSOA(value); ok {
+			t.Errorf("%q: expected not to parse", value)
+		}
+	}
+}
+
+// resolvers count the TTL down, which mustn't change the value that's compared
+func TestSOAValueIgnoresTTL(t *testing.T) {
+	var values []string
+
+	for _, ttl := range []string{"3600", "1234"} {
+		rr, err := dns.NewRR("example.com. " + ttl + " IN SOA " + testSOA)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values = append(values, rdata(rr))
+	}
+
+	if values[0] != values[1] || values[0] != testSOA {
+		t.Errorf("SOA values differ with the TTL: %q", values)
+	}
+}
+
+func TestNormaliseSOAValues(t *testing.T) {
+	old := []string{"example.com.\t3600\tIN\tSOA\t" + testSOA}
+
+	if got := normaliseSOAValues(ddrmRecordTypeSOA, old); len(got) != 1 || got[0] != testSOA {
+		t.Errorf("got %q", got)
+	}
+
+	if got := normaliseSOAValues(ddrmRecordTypeTXT, old); got[0] != old[0] {
+		t.Errorf("changed a TXT value: %q", got)
+	}
+}
+
+func TestSerialBefore(t *testing.T) {
+	tests := []struct {
+		a, b   uint32
+		before bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{5, 5, false},
+		{0xffffffff, 1, true},
+		{1, 0xffffffff, false},
+	}
+
+	for _, test := range tests {
+		if got := serialBefore(test.a, test.b); got != test.before {
+			t.Errorf("serialBefore(%d, %d): got %v", test.a, test.b, got)
+		}
+	}
+}
+
+func soaAnswer(serial string) DdrmRecordAnswer {
+	return DdrmRecordAnswer{Values: []string{"ns1.example.com. hostmaster.example.com. " + serial + " 7200 3600 1209600 3600"}}
+}
+
+func TestCheckSOASerialRegression(t *testing.T) {
+	record := DdrmRecordConfig{FQDN: "example.com", Type: ddrmRecordTypeSOA}
+	state := DdrmRecordState{}
+	now := time.Now()
+
+	steps := []struct {
+		serial   string
+		problems int
+	}{
+		{"10", 0},
+		{"9", 1},
+		{"9", 1},
+		{"10", 0},
+		{"11", 0},
+	}
+
+	for i, step := range steps {
+		reasons := checkSOASerial(record, &state, soaAnswer(step.serial), DdrmApproval{}, now)
+
+		if len(reasons) != step.problems {
+			t.Errorf("step %d, serial %s: got %q", i, step.serial, reasons)
+		}
+	}
+
+	if state.HighestSerial != 11 {
+		t.Errorf("highest serial is %d", state.HighestSerial)
+	}
+}
+
+func TestCheckSOASerialStale(t *testing.T) {
+	record := DdrmRecordConfig{FQDN: "example.com", Type: ddrmRecordTypeSOA, SerialStaleAfter: "1h"}
+	state := DdrmRecordState{}
+	now := time.Now()
+
+	if reasons := checkSOASerial(record, &state, soaAnswer("10"), DdrmApproval{}, now); len(reasons) != 0 {
+		t.Errorf("fresh serial: %q", reasons)
+	}
+
+	if reasons := checkSOASerial(record, &state, soaAnswer("10"), DdrmApproval{}, now.Add(2*time.Hour)); len(reasons) != 1 {
+		t.Errorf("stale serial: %q", reasons)
+	}
+}
+
+func TestCheckSOASerialMismatch(t *testing.T) {
+	answer := soaAnswer("10")
+	answer.Resolvers = []DdrmResolverAnswer{
+		{Resolver: "a", Values: soaAnswer("10").Values},
+		{Resolver: "b", Values: soaAnswer("9").Values},
+	}
+
+	reasons := checkSOASerial(DdrmRecordConfig{Type: ddrmRecordTypeSOA}, &DdrmRecordState{}, answer, DdrmApproval{}, time.Now())
+
+	if len(reasons) != 1 {
+		t.Errorf("got %q", reasons)
+	}
+}
+
+func TestCheckSOASerialApproved(t *testing.T) {
+	record := DdrmRecordConfig{FQDN: "example.com", Type: ddrmRecordTypeSOA}
+	state := DdrmRecordState{}
+	now := time.Now()
+
+	checkSOASerial(record, &state, soaAnswer("10"), DdrmApproval{}, now)
+
+	if reasons := checkSOASerial(record, &state, soaAnswer("9"), DdrmApproval{}, now); len(reasons) != 1 {
+		t.Fatalf("regressed serial: %q", reasons)
+	}
+
+	// a copy of the state from before the approval, as an in-flight check would have
+	stale := state
+	approval := DdrmApproval{Values: soaAnswer("9").Values, At: now}
+
+	for _, s := range []*DdrmRecordState{&state, &stale} {
+		if reasons := checkSOASerial(record, s, soaAnswer("9"), approval, now); len(reasons) != 0 {
+			t.Errorf("approved serial: %q", reasons)
+		}
+	}
+
+	// the approval is only applied once, so later regressions are still caught
+	checkSOASerial(record, &state, soaAnswer("12"), approval, now)
+
+	if reasons := checkSOASerial(record, &state, soaAnswer("11"), approval, now); len(reasons) != 1 {
+		t.Errorf("regressed after approval: %q", reasons)
+	}
+}
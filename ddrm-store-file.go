@@ -0,0 +1,205 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets in the file state store's database
+var (
+	ddrmBucketValues    = []byte("values")
+	ddrmBucketFlap      = []byte("flap")
+	ddrmBucketApprovals = []byte("approvals")
+	ddrmBucketHistory   = []byte("history")
+)
+
+// How long to wait for another process to let go of the state file before giving up
+const ddrmStateFileLockTimeout time.Duration = time.Second
+
+// A state store kept in a single bbolt database file, for running without a Redis server
+type fileStateStore struct {
+	db *bolt.DB
+}
+
+func openFileStateStore(path string) (*fileStateStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: ddrmStateFileLockTimeout})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{ddrmBucketValues, ddrmBucketFlap, ddrmBucketApprovals, ddrmBucketHistory} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &fileStateStore{db: db}, nil
+}
+
+// read a JSON value from a bucket, leaving v alone if it isn't there
+func (s *fileStateStore) getJSON(bucket []byte, key string, v any) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		encoded := tx.Bucket(bucket).Get([]byte(key))
+
+		if encoded == nil {
+			return nil
+		}
+
+		return json.Unmarshal(encoded, v)
+	})
+}
+
+func (s *fileStateStore) putJSON(bucket []byte, key string, v any) error {
+	encoded, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), encoded)
+	})
+}
+
+// append a JSON value to a record's own bucket, keyed by sequence so they stay in order,
+// and drop the oldest once there are more than limit of them
+func (s *fileStateStore) appendJSON(bucket []byte, key string, v any, limit int64) error {
+	encoded, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		entries, err := tx.Bucket(bucket).CreateBucketIfNotExists([]byte(key))
+
+		if err != nil {
+			return err
+		}
+
+		sequence, err := entries.NextSequence()
+
+		if err != nil {
+			return err
+		}
+
+		if err = entries.Put(binary.BigEndian.AppendUint64(nil, sequence), encoded); err != nil {
+			return err
+		}
+
+		if limit <= 0 {
+			return nil
+		}
+
+		// collect the keys first, because deleting while iterating with a cursor skips entries
+		var keys [][]byte
+		_ = entries.ForEach(func(k, _ []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+
+		for _, k := range keys[:max(int64(len(keys))-limit, 0)] {
+			if err = entries.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *fileStateStore) GetValues(fqdn string, recordType DdrmRecordType) (values []string, err error) {
+	err = s.getJSON(ddrmBucketValues, cacheKey(fqdn, recordType), &values)
+	return
+}
+
+func (s *fileStateStore) SetValues(fqdn string, recordType DdrmRecordType, values []string) error {
+	return s.putJSON(ddrmBucketValues, cacheKey(fqdn, recordType), values)
+}
+
+func (s *fileStateStore) GetFlapState(fqdn string, recordType DdrmRecordType) (flap DdrmFlapState, err error) {
+	err = s.getJSON(ddrmBucketFlap, cacheKey(fqdn, recordType), &flap)
+	return
+}
+
+func (s *fileStateStore) SetFlapState(fqdn string, recordType DdrmRecordType, flap DdrmFlapState) error {
+	return s.putJSON(ddrmBucketFlap, cacheKey(fqdn, recordType), flap)
+}
+
+func (s *fileStateStore) AddApproval(approval DdrmApproval) error {
+	return s.appendJSON(ddrmBucketApprovals, cacheKey(approval.FQDN, approval.Type), approval, 0)
+}
+
+func (s *fileStateStore) LatestApproval(fqdn string, recordType DdrmRecordType) (approval DdrmApproval, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		approvals := tx.Bucket(ddrmBucketApprovals).Bucket([]byte(cacheKey(fqdn, recordType)))
+
+		if approvals == nil {
+			return nil
+		}
+
+		if _, v := approvals.Cursor().Last(); v != nil {
+			return json.Unmarshal(v, &approval)
+		}
+
+		return nil
+	})
+
+	return
+}
+
+func (s *fileStateStore) AddHistory(fqdn string, recordType DdrmRecordType, entry DdrmHistoryEntry) error {
+	return s.appendJSON(ddrmBucketHistory, cacheKey(fqdn, recordType), entry, historyLength())
+}
+
+// the file stays open for as long as DDRM runs, so it's reachable as long as the database is usable
+func (s *fileStateStore) Ping(ctx context.Context) error {
+	return s.db.View(func(tx *bolt.Tx) error { return nil })
+}
+
+// only one process can have the file open, so this instance always leads
+func (s *fileStateStore) AcquireLease(holder string, lease time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (s *fileStateStore) History(fqdn string, recordType DdrmRecordType, count int64) (history []DdrmHistoryEntry, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(ddrmBucketHistory).Bucket([]byte(cacheKey(fqdn, recordType)))
+
+		if entries == nil {
+			return nil
+		}
+
+		cursor := entries.Cursor()
+		for k, v := cursor.Last(); k != nil && int64(len(history)) < count; k, v = cursor.Prev() {
+			var entry DdrmHistoryEntry
+
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+
+			history = append(history, entry)
+		}
+
+		return nil
+	})
+
+	return
+}
@@ -0,0 +1,312 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Where persistent runtime state is kept when using -cache
+type DdrmStateStore interface {
+	GetValues(fqdn string, recordType DdrmRecordType) ([]string, error)
+	SetValues(fqdn string, recordType DdrmRecordType, values []string) error
+	GetFlapState(fqdn string, recordType DdrmRecordType) (DdrmFlapState, error)
+	SetFlapState(fqdn string, recordType DdrmRecordType, flap DdrmFlapState) error
+	AddApproval(approval DdrmApproval) error
+	LatestApproval(fqdn string, recordType DdrmRecordType) (DdrmApproval, error)
+	AddHistory(fqdn string, recordType DdrmRecordType, entry DdrmHistoryEntry) error
+	History(fqdn string, recordType DdrmRecordType, count int64) ([]DdrmHistoryEntry, error)
+	AcquireLease(holder string, lease time.Duration) (bool, error)
+	Ping(ctx context.Context) error
+}
+
+// Kinds of state store that can be chosen with state_store
+const (
+	ddrmStateStoreRedis  string = "redis"
+	ddrmStateStoreFile   string = "file"
+	ddrmStateStoreMemory string = "memory"
+)
+
+// Where the file state store keeps its database when state_file isn't set
+const ddrmDefaultStateFilePath string = "ddrm-state.db"
+
+// the configured state store, set up by setupStateStore
+var ddrmStateStore DdrmStateStore
+
+// choose the state store from the config, defaulting to Redis like older versions
+func setupStateStore() {
+	if !stateUseCache {
+		return
+	}
+
+	if _, err := time.ParseDuration(appConfig().CacheExpiry); appConfig().CacheExpiry != "" && err != nil {
+		dbgf(ddrmErrorInvalidCacheExpiry, appConfig().CacheExpiry, err)
+		os.Exit(ddrmExitDuringConfig)
+	}
+
+	validateLeaderLease()
+
+	switch appConfig().StateStore {
+	case "", ddrmStateStoreRedis:
+		checkRedisConnection()
+		ddrmStateStore = redisStateStore{}
+	case ddrmStateStoreFile:
+		path := appConfig().StateFile
+		if path == "" {
+			path = ddrmDefaultStateFilePath
+		}
+
+		store, err := openFileStateStore(path)
+
+		// a running DDRM keeps the file locked, and subcommands would otherwise just time out
+		if errors.Is(err, bolt.ErrTimeout) && flag.Arg(0) != "" {
+			fmt.Fprintf(os.Stderr, ddrmErrorStateFileInUse+"\n", path, flag.Arg(0))
+			os.Exit(ddrmExitErrorRunningSubcommand)
+		}
+
+		if err != nil {
+			dbgf(ddrmErrorOpeningStateFile, path, err)
+			os.Exit(ddrmExitDuringConfig)
+		}
+
+		ddrmStateStore = store
+	case ddrmStateStoreMemory:
+		// a subcommand would only see its own empty store, and anything it approved would be lost
+		if flag.Arg(0) != "" {
+			fmt.Fprintf(os.Stderr, ddrmErrorSubcommandMemoryStore+"\n", flag.Arg(0))
+			os.Exit(ddrmExitErrorRunningSubcommand)
+		}
+
+		ddrmStateStore = newMemoryStateStore()
+	default:
+		dbgf(ddrmErrorUnknownStateStore, appConfig().StateStore)
+		os.Exit(ddrmExitDuringConfig)
+	}
+
+	dbgf(ddrmReportUsingStateStore, appConfig().StateStore)
+}
+
+// whether the state store in use is Redis
+func usingRedis() bool {
+	return stateUseCache && (appConfig().StateStore == "" || appConfig().StateStore == ddrmStateStoreRedis)
+}
+
+// how long Redis keeps a record's cached values and flapping state after they were last written,
+// or 0 to keep them forever
+func cacheExpiry() time.Duration {
+	expiry, err := time.ParseDuration(appConfig().CacheExpiry)
+
+	if err != nil || expiry < 0 {
+		return 0
+	}
+
+	return expiry
+}
+
+// the key a record's state is kept under, including the configured prefix
+func cacheKey(fqdn string, recordType DdrmRecordType) string {
+	return appConfig().RedisKeyPrefix + ":" + fqdn + ":" + string(recordType)
+}
+
+// check the cache for current cached data, which is empty without the cache
+// errors are passed back so they can be shown, rather than looking like there's nothing cached
+func getCachedValues(fqdn string, recordType DdrmRecordType) (answer []string, err error) {
+	dbgf(ddrmDebugTryingCache, fqdn, string(recordType))
+
+	answer = []string{}
+
+	if stateUseCache {
+		values, err := ddrmStateStore.GetValues(fqdn, recordType)
+
+		if err != nil {
+			return answer, err
+		}
+
+		return values, nil
+	}
+
+	dbgf(ddrmDebugNoCache, fqdn, string(recordType))
+
+	return
+}
+
+// save values in the cache, replacing whatever was there
+func setCachedValues(fqdn string, recordType DdrmRecordType, answer []string) error {
+	if !stateUseCache {
+		return nil
+	}
+
+	return ddrmStateStore.SetValues(fqdn, recordType, answer)
+}
+
+// check the cache for a record's confirmation and flapping state
+func getCachedFlapState(fqdn string, recordType DdrmRecordType) (flap DdrmFlapState, err error) {
+	if stateUseCache {
+		flap, err = ddrmStateStore.GetFlapState(fqdn, recordType)
+	}
+
+	return
+}
+
+// save a record's confirmation and flapping state in the cache
+func setCachedFlapState(fqdn string, recordType DdrmRecordType, flap DdrmFlapState) error {
+	if !stateUseCache {
+		return nil
+	}
+
+	return ddrmStateStore.SetFlapState(fqdn, recordType, flap)
+}
+
+// keep a record of who approved a baseline and when
+func addCachedApproval(approval DdrmApproval) error {
+	if !stateUseCache {
+		return nil
+	}
+
+	return ddrmStateStore.AddApproval(approval)
+}
+
+// read the newest approval for a record, which has no FQDN if it's never been approved
+func getCachedApproval(fqdn string, recordType DdrmRecordType) (approval DdrmApproval, err error) {
+	if stateUseCache {
+		approval, err = ddrmStateStore.LatestApproval(fqdn, recordType)
+	}
+
+	return
+}
+
+// append an entry to a record's history
+func addCachedHistory(fqdn string, recordType DdrmRecordType, entry DdrmHistoryEntry) error {
+	if !stateUseCache {
+		return nil
+	}
+
+	return ddrmStateStore.AddHistory(fqdn, recordType, entry)
+}
+
+// read up to count of a record's newest history entries, newest first
+func getCachedHistory(fqdn string, recordType DdrmRecordType, count int64) (history []DdrmHistoryEntry, err error) {
+	if stateUseCache {
+		history, err = ddrmStateStore.History(fqdn, recordType, count)
+	}
+
+	return
+}
+
+// A state store that only lasts as long as the process, for trying DDRM out or running without any persistence
+type memoryStateStore struct {
+	lock      sync.Mutex
+	values    map[string][]string
+	flaps     map[string]DdrmFlapState
+	approvals map[string][]DdrmApproval
+	history   map[string][]DdrmHistoryEntry
+}
+
+func newMemoryStateStore() *memoryStateStore {
+	return &memoryStateStore{
+		values:    map[string][]string{},
+		flaps:     map[string]DdrmFlapState{},
+		approvals: map[string][]DdrmApproval{},
+		history:   map[string][]DdrmHistoryEntry{},
+	}
+}
+
+func (s *memoryStateStore) GetValues(fqdn string, recordType DdrmRecordType) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string{}, s.values[cacheKey(fqdn, recordType)]...), nil
+}
+
+func (s *memoryStateStore) SetValues(fqdn string, recordType DdrmRecordType, values []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.values[cacheKey(fqdn, recordType)] = append([]string{}, values...)
+
+	return nil
+}
+
+func (s *memoryStateStore) GetFlapState(fqdn string, recordType DdrmRecordType) (DdrmFlapState, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.flaps[cacheKey(fqdn, recordType)], nil
+}
+
+func (s *memoryStateStore) SetFlapState(fqdn string, recordType DdrmRecordType, flap DdrmFlapState) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.flaps[cacheKey(fqdn, recordType)] = flap
+
+	return nil
+}
+
+func (s *memoryStateStore) AddApproval(approval DdrmApproval) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := cacheKey(approval.FQDN, approval.Type)
+	s.approvals[key] = append(s.approvals[key], approval)
+
+	return nil
+}
+
+func (s *memoryStateStore) LatestApproval(fqdn string, recordType DdrmRecordType) (approval DdrmApproval, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if approvals := s.approvals[cacheKey(fqdn, recordType)]; len(approvals) > 0 {
+		approval = approvals[len(approvals)-1]
+	}
+
+	return
+}
+
+func (s *memoryStateStore) AddHistory(fqdn string, recordType DdrmRecordType, entry DdrmHistoryEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := cacheKey(fqdn, recordType)
+	history := append(s.history[key], entry)
+
+	if excess := int64(len(history)) - historyLength(); excess > 0 {
+		history = history[excess:]
+	}
+
+	s.history[key] = history
+
+	return nil
+}
+
+func (s *memoryStateStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// nothing else can share an in-memory store, so this instance always leads
+func (s *memoryStateStore) AcquireLease(holder string, lease time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (s *memoryStateStore) History(fqdn string, recordType DdrmRecordType, count int64) (history []DdrmHistoryEntry, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries := s.history[cacheKey(fqdn, recordType)]
+
+	for i := len(entries) - 1; i >= 0 && int64(len(history)) < count; i-- {
+		history = append(history, entries[i])
+	}
+
+	return
+}
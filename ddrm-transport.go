@@ -0,0 +1,402 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// Resolver URL schemes for encrypted transports
+const (
+	ddrmTransportTLS   string = "tls"
+	ddrmTransportHTTPS string = "https"
+	ddrmTransportQUIC  string = "quic"
+)
+
+// Default ports for the encrypted transports, from RFC 7858 and RFC 9250
+const (
+	ddrmDefaultDoTPort string = "853"
+	ddrmDefaultDoQPort string = "853"
+)
+
+// The CA bundle for verifying encrypted resolvers, loaded once per configured path
+var (
+	dnsRootCAs     *x509.CertPool
+	dnsRootCAsPath string
+	dnsRootCAsLock sync.Mutex
+)
+
+// A DoH resolver's HTTP client, kept so its connections are reused between questions
+type DdrmDoHClient struct {
+	client *http.Client
+	roots  *x509.CertPool
+}
+
+// The HTTP client for each DoH resolver, by its URL
+var (
+	dohClients     = map[string]DdrmDoHClient{}
+	dohClientsLock sync.Mutex
+)
+
+// A DoQ resolver's QUIC connection, kept so each question doesn't need a new handshake
+type DdrmDoQConn struct {
+	conn  *quic.Conn
+	roots *x509.CertPool
+}
+
+// The QUIC connection for each DoQ resolver, by its address and server name
+var (
+	doqConns     = map[string]DdrmDoQConn{}
+	doqConnsLock sync.Mutex
+)
+
+// the CA pool to verify resolver certificates with: the configured bundle, or nil for the system roots
+func dnsCAPool() (*x509.CertPool, error) {
+	dnsRootCAsLock.Lock()
+	defer dnsRootCAsLock.Unlock()
+
+	path := appConfig().DnsTlsCaFile
+
+	if path == "" {
+		return nil, nil
+	}
+
+	if dnsRootCAs != nil && dnsRootCAsPath == path {
+		return dnsRootCAs, nil
+	}
+
+	pem, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf(ddrmErrorNoCertificatesInBundle, path)
+	}
+
+	dnsRootCAs = pool
+	dnsRootCAsPath = path
+
+	return pool, nil
+}
+
+// TLS config that verifies the resolver's certificate against the server name in its URL,
+// which can be overridden with ?server_name= when the URL uses an IP address
+func dnsTLSConfig(resolver *url.URL) (*tls.Config, error) {
+	pool, err := dnsCAPool()
+
+	if err != nil {
+		return nil, err
+	}
+
+	serverName := resolver.Hostname()
+	if name := resolver.Query().Get("server_name"); name != "" {
+		serverName = name
+	}
+
+	return &tls.Config{
+		ServerName: serverName,
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// whether a resolver is configured as a URL rather than a plain <hostname>:<port>
+func isResolverURL(server string) bool {
+	return strings.Contains(server, "://")
+}
+
+// send a question to a resolver configured as a URL, using the transport its scheme asks for
+func exchangeURL(server string, msg *dns.Msg) (*dns.Msg, error) {
+	resolver, err := url.Parse(server)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := dnsTLSConfig(resolver)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch resolver.Scheme {
+	case ddrmTransportTLS:
+		return exchangeTLS(hostWithDefaultPort(resolver, ddrmDefaultDoTPort), tlsConfig, msg)
+	case ddrmTransportHTTPS:
+		return exchangeHTTPS(resolver, tlsConfig, msg)
+	case ddrmTransportQUIC:
+		return exchangeQUIC(hostWithDefaultPort(resolver, ddrmDefaultDoQPort), tlsConfig, msg)
+	}
+
+	return nil, fmt.Errorf(ddrmErrorUnknownTransport, resolver.Scheme, server)
+}
+
+func hostWithDefaultPort(resolver *url.URL, port string) string {
+	if resolver.Port() != "" {
+		return resolver.Host
+	}
+
+	return net.JoinHostPort(resolver.Hostname(), port)
+}
+
+// DNS-over-TLS, RFC 7858
+func exchangeTLS(address string, tlsConfig *tls.Config, msg *dns.Msg) (*dns.Msg, error) {
+	dnsclient := newDnsClient()
+	dnsclient.Net = "tcp-tls"
+	dnsclient.TLSConfig = tlsConfig
+
+	in, _, err := dnsclient.Exchange(msg, address)
+
+	return in, err
+}
+
+// DNS-over-HTTPS, RFC 8484, using POST so the question doesn't need encoding into the URL
+func exchangeHTTPS(resolver *url.URL, tlsConfig *tls.Config, msg *dns.Msg) (*dns.Msg, error) {
+	// the ID should be zero to help HTTP caches, so ask with a copy
+	question := msg.Copy()
+	question.Id = 0
+
+	packed, err := question.Pack()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// don't send our server_name override to the resolver
+	endpoint := *resolver
+	query := endpoint.Query()
+	query.Del("server_name")
+	endpoint.RawQuery = query.Encode()
+
+	ctx, cancel := context.WithTimeout(context.Background(), stateDNSTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(packed))
+
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/dns-message")
+	request.Header.Set("Accept", "application/dns-message")
+
+	response, err := dohClient(resolver, tlsConfig).Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(ddrmErrorDoHStatus, resolver.String(), response.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, dns.MaxMsgSize))
+
+	if err != nil {
+		return nil, err
+	}
+
+	in := new(dns.Msg)
+
+	if err = in.Unpack(body); err != nil {
+		return nil, err
+	}
+
+	in.Id = msg.Id
+
+	return in, nil
+}
+
+// the HTTP client for a DoH resolver, which is only replaced when the CA bundle it verifies with changes
+func dohClient(resolver *url.URL, tlsConfig *tls.Config) *http.Client {
+	dohClientsLock.Lock()
+	defer dohClientsLock.Unlock()
+
+	key := resolver.String()
+	existing, found := dohClients[key]
+
+	if found && existing.roots == tlsConfig.RootCAs {
+		return existing.client
+	}
+
+	if found {
+		existing.client.CloseIdleConnections()
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	client := &http.Client{Transport: transport}
+	dohClients[key] = DdrmDoHClient{client: client, roots: tlsConfig.RootCAs}
+
+	return client
+}
+
+// DNS-over-QUIC, RFC 9250: one question per stream, each message prefixed with its length
+func exchangeQUIC(address string, tlsConfig *tls.Config, msg *dns.Msg) (*dns.Msg, error) {
+	question := msg.Copy()
+	question.Id = 0
+
+	packed, err := question.Pack()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stateDNSTimeout)
+	defer cancel()
+
+	tlsConfig.NextProtos = []string{"doq"}
+
+	conn, reused, err := doqConn(ctx, address, tlsConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	in, err := exchangeQUICStream(ctx, conn, address, packed)
+
+	// the resolver might have closed a kept connection since it was last used, so try once more on a new one
+	if err != nil && reused {
+		forgetDoQConn(address, tlsConfig, conn)
+
+		if conn, _, err = doqConn(ctx, address, tlsConfig); err != nil {
+			return nil, err
+		}
+
+		in, err = exchangeQUICStream(ctx, conn, address, packed)
+	}
+
+	if err != nil {
+		forgetDoQConn(address, tlsConfig, conn)
+		return nil, err
+	}
+
+	in.Id = msg.Id
+
+	return in, nil
+}
+
+// ask one question on a new stream of a QUIC connection
+func exchangeQUICStream(ctx context.Context, conn *quic.Conn, address string, packed []byte) (*dns.Msg, error) {
+	stream, err := conn.OpenStreamSync(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	prefixed := binary.BigEndian.AppendUint16(nil, uint16(len(packed)))
+
+	if _, err = stream.Write(append(prefixed, packed...)); err != nil {
+		return nil, err
+	}
+
+	// closing our side of the stream tells the server that's the whole question
+	if err = stream.Close(); err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetReadDeadline(deadline)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(stream, dns.MaxMsgSize+2))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) < 2 || int(binary.BigEndian.Uint16(body)) != len(body)-2 {
+		return nil, fmt.Errorf(ddrmErrorDoQShortResponse, address)
+	}
+
+	in := new(dns.Msg)
+
+	if err = in.Unpack(body[2:]); err != nil {
+		return nil, err
+	}
+
+	return in, nil
+}
+
+func doqConnKey(address string, tlsConfig *tls.Config) string {
+	return address + "|" + tlsConfig.ServerName
+}
+
+// the QUIC connection for a DoQ resolver, dialling a new one if there isn't one that's still open,
+// or the CA bundle it was verified with has changed
+func doqConn(ctx context.Context, address string, tlsConfig *tls.Config) (conn *quic.Conn, reused bool, err error) {
+	key := doqConnKey(address, tlsConfig)
+
+	doqConnsLock.Lock()
+	existing, found := doqConns[key]
+	doqConnsLock.Unlock()
+
+	if found && existing.roots == tlsConfig.RootCAs && existing.conn.Context().Err() == nil {
+		return existing.conn, true, nil
+	}
+
+	// dial without holding the lock, so a slow resolver doesn't hold up questions for the others
+	conn, err = quic.DialAddr(ctx, address, tlsConfig, nil)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	doqConnsLock.Lock()
+	defer doqConnsLock.Unlock()
+
+	if current, found := doqConns[key]; found && current.conn != existing.conn {
+		// another question got a new connection in first, so keep that one
+		if current.roots == tlsConfig.RootCAs && current.conn.Context().Err() == nil {
+			_ = conn.CloseWithError(0, "")
+			return current.conn, true, nil
+		}
+
+		_ = current.conn.CloseWithError(0, "")
+	}
+
+	if found {
+		_ = existing.conn.CloseWithError(0, "")
+	}
+
+	doqConns[key] = DdrmDoQConn{conn: conn, roots: tlsConfig.RootCAs}
+
+	return conn, false, nil
+}
+
+// close a DoQ resolver's connection after it failed, so the next question dials a new one
+func forgetDoQConn(address string, tlsConfig *tls.Config, conn *quic.Conn) {
+	doqConnsLock.Lock()
+	defer doqConnsLock.Unlock()
+
+	key := doqConnKey(address, tlsConfig)
+
+	if current, found := doqConns[key]; found && current.conn == conn {
+		delete(doqConns, key)
+	}
+
+	_ = conn.CloseWithError(0, "")
+}
@@ -0,0 +1,282 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// answer every A question with 192.0.2.1
+func testDnsAnswer(question *dns.Msg) *dns.Msg {
+	answer := new(dns.Msg)
+	answer.SetReply(question)
+
+	rr, _ := dns.NewRR(question.Question[0].Name + " 300 IN A 192.0.2.1")
+	answer.Answer = append(answer.Answer, rr)
+
+	return answer
+}
+
+// trust a test server's certificate by making it the configured CA bundle
+func trustTestCertificate(t *testing.T, server *httptest.Server) {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	if err := os.WriteFile(path, encoded, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := appConfig()
+	config := *previous
+	config.DnsTlsCaFile = path
+	ddrmAppConfig.Store(&config)
+
+	t.Cleanup(func() { ddrmAppConfig.Store(previous) })
+}
+
+// a TLS server whose certificate is trusted for the duration of the test
+func newTestTLSServer(t *testing.T, handler http.Handler) *httptest.Server {
+	server := httptest.NewTLSServer(handler)
+
+	t.Cleanup(server.Close)
+	trustTestCertificate(t, server)
+
+	return server
+}
+
+// a DoH server that answers POSTed DNS messages
+func newTestDoHServer(t *testing.T) *httptest.Server {
+	return newTestTLSServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		question := new(dns.Msg)
+
+		if err := question.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		packed, _ := testDnsAnswer(question).Pack()
+
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(packed)
+	}))
+}
+
+func checkTestAnswer(t *testing.T, in *dns.Msg, question *dns.Msg, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if in.Id != question.Id {
+		t.Errorf("answer has ID %d, expected %d", in.Id, question.Id)
+	}
+
+	if len(in.Answer) != 1 || in.Answer[0].(*dns.A).A.String() != "192.0.2.1" {
+		t.Errorf("unexpected answer: %v", in.Answer)
+	}
+}
+
+func TestExchangeDoH(t *testing.T) {
+	server := newTestDoHServer(t)
+	resolver := server.URL + "/dns-query"
+
+	var clients []*http.Client
+
+	for i := 0; i < 2; i++ {
+		question := newQuestion("example.com", ddrmRecordTypeA)
+		in, err := exchangeURL(resolver, question)
+
+		checkTestAnswer(t, in, question, err)
+
+		dohClientsLock.Lock()
+		clients = append(clients, dohClients[resolver].client)
+		dohClientsLock.Unlock()
+	}
+
+	if clients[0] == nil || clients[0] != clients[1] {
+		t.Error("expected the resolver's HTTP client to be kept between questions")
+	}
+}
+
+func TestExchangeDoHStatus(t *testing.T) {
+	server := newTestTLSServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	}))
+
+	if _, err := exchangeURL(server.URL+"/dns-query", newQuestion("example.com", ddrmRecordTypeA)); err == nil {
+		t.Error("expected an error from a resolver that isn't answering")
+	}
+}
+
+func TestExchangeDoT(t *testing.T) {
+	// borrow the DoH test server's certificate, which is valid for 127.0.0.1
+	certificates := newTestDoHServer(t).TLS.Certificates
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certificates})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	server := &dns.Server{
+		Listener:          listener,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, question *dns.Msg) {
+			_ = w.WriteMsg(testDnsAnswer(question))
+		}),
+	}
+
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	<-started
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	question := newQuestion("example.com", ddrmRecordTypeA)
+	in, err := exchangeURL("tls://127.0.0.1:"+port, question)
+
+	checkTestAnswer(t, in, question, err)
+}
+
+func TestExchangeDoTUntrusted(t *testing.T) {
+	certificates := newTestDoHServer(t).TLS.Certificates
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certificates})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	// the certificate is only valid for 127.0.0.1 and example.com
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	if _, err := exchangeURL("tls://127.0.0.1:"+port+"?server_name=dns.example", newQuestion("example.com", ddrmRecordTypeA)); err == nil {
+		t.Error("expected the certificate to be refused for the wrong server name")
+	}
+}
+
+// a DoQ server that answers a length-prefixed question on each stream, counting the connections it accepts
+func newTestDoQServer(t *testing.T) (address string, connections *atomic.Int32) {
+	certificates := newTestDoHServer(t).TLS.Certificates
+	listener, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{Certificates: certificates, NextProtos: []string{"doq"}}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	connections = &atomic.Int32{}
+
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+
+			if err != nil {
+				return
+			}
+
+			connections.Add(1)
+
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+
+					if err != nil {
+						return
+					}
+
+					body, _ := io.ReadAll(stream)
+					question := new(dns.Msg)
+
+					if len(body) < 2 || question.Unpack(body[2:]) != nil {
+						stream.CancelWrite(0)
+						continue
+					}
+
+					packed, _ := testDnsAnswer(question).Pack()
+					_, _ = stream.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(packed))), packed...))
+					stream.Close()
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), connections
+}
+
+func TestExchangeDoQ(t *testing.T) {
+	address, connections := newTestDoQServer(t)
+
+	for i := 0; i < 2; i++ {
+		question := newQuestion("example.com", ddrmRecordTypeA)
+		in, err := exchangeURL("quic://"+address, question)
+
+		checkTestAnswer(t, in, question, err)
+	}
+
+	if n := connections.Load(); n != 1 {
+		t.Errorf("expected the resolver's QUIC connection to be kept between questions, but it was dialled %d times", n)
+	}
+}
+
+func TestExchangeDoQRedials(t *testing.T) {
+	address, connections := newTestDoQServer(t)
+	resolver := "quic://" + address
+
+	question := newQuestion("example.com", ddrmRecordTypeA)
+	in, err := exchangeURL(resolver, question)
+	checkTestAnswer(t, in, question, err)
+
+	// a connection the resolver has since closed is replaced rather than failing the question
+	doqConnsLock.Lock()
+	for _, c := range doqConns {
+		_ = c.conn.CloseWithError(0, "")
+	}
+	doqConnsLock.Unlock()
+
+	question = newQuestion("example.com", ddrmRecordTypeA)
+	in, err = exchangeURL(resolver, question)
+	checkTestAnswer(t, in, question, err)
+
+	if n := connections.Load(); n != 2 {
+		t.Errorf("expected a new connection after the old one closed, but it was dialled %d times", n)
+	}
+}
@@ -4,11 +4,15 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/muesli/termenv"
@@ -16,7 +20,15 @@ import (
 
 // TUI state
 type UiModel struct {
-	recordTable table.Model
+	recordTable   table.Model
+	status        string
+	showHistory   bool
+	historyTable  table.Model
+	editing       bool
+	editFQDN      string
+	editType      DdrmRecordType
+	editInput     textinput.Model
+	confirmRemove bool
 }
 
 // TUI msg struct that supports String()
@@ -47,13 +59,72 @@ func (ui UiModel) Init() tea.Cmd {
 }
 
 func (ui UiModel) View() string {
+	if ui.showHistory {
+		return uiBaseStyle.Render(ui.historyTable.View()) + "\n\n" +
+			helpText("h/esc: back to records • q: exit  ") + highlightText(ui.status+"\n")
+	}
+
+	if ui.editing {
+		return uiBaseStyle.Render(ui.recordTable.View()) + "\n\n" +
+			ui.editInput.View() + "\n" +
+			helpText("enter: save • esc: cancel  ") + highlightText(ui.status+"\n")
+	}
+
 	return uiBaseStyle.Render(ui.recordTable.View()) + "\n\n" +
-		helpText("q: exit • x: toggle altscreen mode  ") + highlightText(fmt.Sprint(len(ddrmRecordStates))+" records\n")
+		helpText("q: exit • x: toggle altscreen mode • a: approve change • h: history • n: new record • e: edit • d: remove  ") + highlightText(fmt.Sprint(len(recordStatesSnapshot()))+" records"+uiLeadershipRole()+"\n") +
+		helpText(ui.status)
 }
 
 func (ui UiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		// the history view only needs a way back to the records, and scrolling
+		if ui.showHistory {
+			switch msg.String() {
+			case "h", "esc":
+				ui.showHistory = false
+				ui.status = ""
+				return ui.refresh(), nil
+			case "q", "ctrl+c":
+				cronScheduler.Shutdown()
+				return ui, tea.Quit
+			}
+
+			ui.historyTable, _ = ui.historyTable.Update(msg)
+			return ui, nil
+		}
+
+		// the record editor gets every key, so record configs can be typed out
+		if ui.editing {
+			switch msg.String() {
+			case "esc":
+				ui.editing = false
+				ui.status = ""
+				return ui.refresh(), nil
+			case "enter":
+				return ui.saveEdit(), nil
+			case "ctrl+c":
+				cronScheduler.Shutdown()
+				return ui, tea.Quit
+			}
+
+			var cmd tea.Cmd
+			ui.editInput, cmd = ui.editInput.Update(msg)
+			return ui, cmd
+		}
+
+		// removing a record needs confirming, and any other key cancels it
+		if ui.confirmRemove {
+			ui.confirmRemove = false
+			ui.status = ""
+
+			if msg.String() == "y" {
+				return ui.removeSelected(), nil
+			}
+
+			return ui.refresh(), nil
+		}
+
 		switch msg.String() {
 		case "q", "ctrl+c", "esc":
 			cronScheduler.Shutdown()
@@ -67,32 +138,235 @@ func (ui UiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			stateAltScreenMode = !stateAltScreenMode
 			return ui, cmd
+		case "a":
+			return ui.approveSelected(), nil
+		case "h":
+			return ui.historyOfSelected(), nil
+		case "n":
+			return ui.editRecord(DdrmRecordConfig{Type: ddrmRecordTypes[0], ExpectedValues: []string{}}, false), textinput.Blink
+		case "e":
+			if row := ui.recordTable.SelectedRow(); row != nil {
+				if record, found := recordConfig(row[1], DdrmRecordType(row[2])); found {
+					return ui.editRecord(record, true), textinput.Blink
+				}
+			}
+		case "d":
+			if row := ui.recordTable.SelectedRow(); row != nil {
+				ui.confirmRemove = true
+				ui.status = fmt.Sprintf(ddrmReportConfirmRemove, row[1], row[2])
+			}
+		default:
+			// let the table move its cursor
+			ui.recordTable, _ = ui.recordTable.Update(msg)
 		}
 	case uiProcessRecords:
-		return updateUi(), nil
+		return ui.refresh(), nil
+	}
+
+	// keep the editor's cursor blinking
+	if ui.editing {
+		var cmd tea.Cmd
+		ui.editInput, cmd = ui.editInput.Update(msg)
+		return ui.refresh(), cmd
 	}
 
-	return updateUi(), nil
+	return ui.refresh(), nil
 }
 
-func updateUi() UiModel {
+// rebuild the table from the latest record states, keeping the cursor and status
+func (ui UiModel) refresh() UiModel {
+	updated := updateUi()
+	updated.recordTable.SetCursor(ui.recordTable.Cursor())
+	updated.status = ui.status
+	updated.showHistory = ui.showHistory
+	updated.historyTable = ui.historyTable
+	updated.editing = ui.editing
+	updated.editFQDN = ui.editFQDN
+	updated.editType = ui.editType
+	updated.editInput = ui.editInput
+	updated.confirmRemove = ui.confirmRemove
+
+	return updated
+}
+
+// approve the selected record's current values as its new baseline
+func (ui UiModel) approveSelected() UiModel {
+	row := ui.recordTable.SelectedRow()
+
+	if row == nil {
+		return ui.refresh()
+	}
+
+	fqdn, recordType := row[1], DdrmRecordType(row[2])
+	state := getRecordState(fqdn + ":" + string(recordType))
+
+	approval, err := approveRecord(fqdn, recordType, state.CurrentValues, localUsername())
+
+	if err != nil {
+		ui.status = err.Error()
+	} else {
+		ui.status = fmt.Sprintf(ddrmReportApproved, approval.FQDN, string(approval.Type), approval.Values, approval.By)
+	}
+
+	return ui.refresh()
+}
+
+// open the record editor, with the record's config as JSON to change
+func (ui UiModel) editRecord(record DdrmRecordConfig, existing bool) UiModel {
+	encoded, _ := json.Marshal(record)
+
+	ui.editInput = textinput.New()
+	ui.editInput.Prompt = "record: "
+	ui.editInput.Width = 100
+	ui.editInput.SetValue(string(encoded))
+	ui.editInput.Focus()
+
+	ui.editing = true
+	ui.editFQDN, ui.editType = "", ""
+	ui.status = ""
+
+	if existing {
+		ui.editFQDN, ui.editType = record.FQDN, record.Type
+	}
+
+	return ui.refresh()
+}
+
+// add or update the record being edited, staying in the editor to fix any problem with it
+func (ui UiModel) saveEdit() UiModel {
+	var record DdrmRecordConfig
+
+	decoder := json.NewDecoder(strings.NewReader(ui.editInput.Value()))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&record)
+
+	if err != nil {
+		err = fmt.Errorf(ddrmErrorRecordChangeBody, err)
+	} else if ui.editFQDN == "" {
+		err = addRecord(record, localUsername())
+	} else {
+		err = updateRecord(ui.editFQDN, ui.editType, record, localUsername())
+	}
+
+	if err != nil {
+		ui.status = err.Error()
+		return ui.refresh()
+	}
+
+	ui.editing = false
+	ui.status = fmt.Sprintf(ddrmReportRecordSaved, record.FQDN, string(record.Type))
+
+	return ui.refresh()
+}
+
+// stop monitoring the selected record
+func (ui UiModel) removeSelected() UiModel {
+	row := ui.recordTable.SelectedRow()
+
+	if row == nil {
+		return ui.refresh()
+	}
+
+	if err := removeRecord(row[1], DdrmRecordType(row[2]), localUsername()); err != nil {
+		ui.status = err.Error()
+	} else {
+		ui.status = fmt.Sprintf(ddrmReportRecordRemoved, row[1], row[2], localUsername())
+	}
+
+	return ui.refresh()
+}
+
+// browse the selected record's history, newest first
+func (ui UiModel) historyOfSelected() UiModel {
+	row := ui.recordTable.SelectedRow()
+
+	if row == nil {
+		return ui.refresh()
+	}
+
+	fqdn, recordType := row[1], DdrmRecordType(row[2])
+
+	if !stateUseCache {
+		ui.status = ddrmErrorHistoryNeedsCache
+		return ui.refresh()
+	}
+
 	columns := []table.Column{
+		{Title: "At", Width: 25},
+		{Title: "Response", Width: 8},
+		{Title: "Before", Width: 30},
+		{Title: "After", Width: 30},
+		{Title: "Resolver", Width: 20},
+	}
+
+	history, err := getCachedHistory(fqdn, recordType, historyLength())
+
+	if err != nil {
+		ui.status = err.Error()
+		return ui.refresh()
+	}
+
+	rows := []table.Row{}
+
+	for _, h := range history {
+		rows = append(rows, table.Row{
+			h.At.Format(time.RFC3339),
+			string(h.Response),
+			historyValues(h.OldValues),
+			historyValues(h.NewValues),
+			h.Resolver,
+		})
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithFocused(true),
+		table.WithHeight(min(len(rows), int(ddrmHistoryShown))),
+	)
+
+	t.SetStyles(uiTableStyles())
+
+	ui.historyTable = t
+	ui.showHistory = true
+	ui.status = fmt.Sprintf(ddrmReportHistoryShown, len(rows), fqdn, string(recordType))
+
+	return ui
+}
+
+// the record table's columns, shared by the TUI and the web UI
+func uiColumns() []table.Column {
+	return []table.Column{
 		{Title: "-", Width: 1},
 		{Title: "FQDN", Width: 30},
 		{Title: "RR", Width: 4},
 		{Title: "Expected", Width: 20},
-		{Title: "Currently", Width: 20},
+		{Title: "Currently", Width: 26},
+		{Title: "Response", Width: 8},
 		{Title: "✉︎", Width: 1},
 		{Title: "↓", Width: 1},
 		{Title: "⚠️", Width: 1},
+		{Title: "≠", Width: 1},
+		{Title: "🔏", Width: 1},
+		{Title: "⏱", Width: 1},
+		{Title: "#", Width: 1},
+		{Title: "⛔", Width: 1},
+		{Title: "~", Width: 1},
+		{Title: "💾", Width: 1},
 	}
+}
 
+// turn every record state into a table row, sorted by record, for the TUI and the web UI
+func uiRows() []table.Row {
 	rows := []table.Row{}
 
 	// golang doesn't have an ordered map type, so we need to extract the keys,
 	// sort those, and then index into the record states map with the sorted key
+	states := recordStatesSnapshot()
+
 	keys := make([]string, 0)
-	for k := range ddrmRecordStates {
+	for k := range states {
 		keys = append(keys, k)
 	}
 
@@ -100,7 +374,7 @@ func updateUi() UiModel {
 
 	// turn each record state into a row
 	for _, k := range keys {
-		rowState := ddrmRecordStates[k]
+		rowState := states[k]
 
 		processing := ""
 		if rowState.Processing {
@@ -113,8 +387,22 @@ func updateUi() UiModel {
 		}
 
 		changed := ""
-		if rowState.Changed {
+		if rowState.Unacknowledged {
+			changed = "!"
+		} else if rowState.Changed {
 			changed = "x"
+		} else if rowState.PendingChange {
+			changed = "?"
+		}
+
+		cacheError := ""
+		if rowState.CacheError != "" {
+			cacheError = "x"
+		}
+
+		flapping := ""
+		if rowState.Flap.Flapping {
+			flapping = "x"
 		}
 
 		errored := ""
@@ -122,6 +410,17 @@ func updateUi() UiModel {
 			errored = "x"
 		}
 
+		disagree := ""
+		if rowState.Disagree {
+			disagree = "x"
+		}
+
+		// show the first letter of the DNSSEC status when it needs attention
+		dnssec := ""
+		if dnssecAlerting(rowState.Dnssec) {
+			dnssec = strings.ToUpper(string(rowState.Dnssec)[:1])
+		}
+
 		prior := ""
 		if len(rowState.PriorValues) == 1 {
 			prior = rowState.PriorValues[0]
@@ -129,11 +428,27 @@ func updateUi() UiModel {
 			prior = rowState.PriorValues[0] + ", ..."
 		}
 
+		ttl := ""
+		if rowState.TTLAlert {
+			ttl = "x"
+		}
+
+		serial := ""
+		if rowState.SOAAlert {
+			serial = "x"
+		}
+
+		forbidden := ""
+		if rowState.Forbidden {
+			forbidden = "x"
+		}
+
 		current := ""
-		if len(rowState.CurrentValues) == 1 {
-			current = rowState.CurrentValues[0]
-		} else if len(rowState.CurrentValues) > 1 {
-			current = rowState.CurrentValues[0] + ", ..."
+		currentValues := withTTLs(rowState.CurrentValues, rowState.TTLs)
+		if len(currentValues) == 1 {
+			current = currentValues[0]
+		} else if len(currentValues) > 1 {
+			current = currentValues[0] + ", ..."
 		}
 
 		row := table.Row{
@@ -142,21 +457,52 @@ func updateUi() UiModel {
 			string(rowState.Type),
 			prior,
 			current,
+			string(rowState.Response),
 			email,
 			changed,
 			errored,
+			disagree,
+			dnssec,
+			ttl,
+			serial,
+			forbidden,
+			flapping,
+			cacheError,
 		}
 
 		rows = append(rows, row)
 	}
 
+	return rows
+}
+
+func updateUi() UiModel {
+	rows := uiRows()
+
 	t := table.New(
-		table.WithColumns(columns),
+		table.WithColumns(uiColumns()),
 		table.WithRows(rows),
 		table.WithFocused(true),
 		table.WithHeight(len(rows)),
 	)
 
+	t.SetStyles(uiTableStyles())
+
+	uiModel := UiModel{recordTable: t}
+
+	return uiModel
+}
+
+// show whether this instance is leading when leader election is turned on
+func uiLeadershipRole() string {
+	if role := leadershipRole(); role != "" {
+		return " • " + role
+	}
+
+	return ""
+}
+
+func uiTableStyles() table.Styles {
 	style := table.DefaultStyles()
 	style.Header = style.Header.BorderStyle(lipgloss.NormalBorder()).
 		BorderForeground(lipgloss.Color("240")).
@@ -167,11 +513,7 @@ func updateUi() UiModel {
 		Background(lipgloss.Color("57")).
 		Bold(false)
 
-	t.SetStyles(style)
-
-	uiModel := UiModel{t}
-
-	return uiModel
+	return style
 }
 
 func sendUpdateUIMsg() {
@@ -0,0 +1,266 @@
+//go:build client
+// +build client
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+)
+
+// HTTP endpoints for the web UI
+const (
+	ddrmHttpPathWeb       string = "/"
+	ddrmHttpPathWebRecord string = "/records/"
+)
+
+// The web UI never refreshes more often than this, however short -sleep is
+const ddrmWebMinimumRefresh time.Duration = 5 * time.Second
+
+// What each of the record table's columns means, shown when hovering over its title
+var ddrmWebColumnHelp = map[string]string{
+	"-":  "about to be processed again",
+	"✉︎": "an email was sent about a change",
+	"↓":  "changed, or ! when waiting for approval, or ? when waiting for confirmations",
+	"⚠️": "couldn't be resolved",
+	"≠":  "the resolvers disagree",
+	"🔏":  "DNSSEC needs attention: bogus, expiring or mismatch",
+	"⏱":  "a TTL is outside min_ttl or max_ttl",
+	"#":  "a problem with the SOA serial",
+	"⛔":  "returned one of its forbidden_values",
+	"~":  "flapping between answers",
+	"💾":  "reading or writing the cache failed",
+}
+
+// The web UI's record table
+type DdrmWebRecords struct {
+	Columns     []table.Column
+	Rows        []table.Row
+	Refresh     int
+	Role        string
+	GeneratedAt time.Time
+}
+
+// A history entry with what changed in it
+type DdrmWebHistoryEntry struct {
+	DdrmHistoryEntry
+	Added   []string
+	Removed []string
+}
+
+// The web UI's page for a single record
+type DdrmWebRecord struct {
+	Config       DdrmRecordConfig
+	State        DdrmRecordState
+	Current      []string
+	Added        []string
+	Removed      []string
+	FlapSummary  []string
+	History      []DdrmWebHistoryEntry
+	HistoryError string
+	Refresh      int
+	GeneratedAt  time.Time
+}
+
+var ddrmWebTemplates = template.Must(template.New("web").Funcs(template.FuncMap{
+	"recordPath": webRecordPath,
+	"columnHelp": func(title string) string { return ddrmWebColumnHelp[title] },
+	"values":     historyValues,
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+
+		return t.Format(time.RFC1123)
+	},
+}).Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>DDRM</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; font-weight: normal; }
+tr.alert td { background: #fff0f0; }
+.added { color: #070; }
+.removed { color: #a00; text-decoration: line-through; }
+.muted { color: #888; }
+</style>
+</head>
+<body>
+{{end}}
+
+{{define "foot"}}<p class="muted">Generated {{time .GeneratedAt}}, refreshing every {{.Refresh}} seconds.</p>
+</body>
+</html>
+{{end}}
+
+{{define "records"}}{{template "head" .}}
+<h1>DDRM</h1>
+<p>{{len .Rows}} records{{with .Role}} • {{.}}{{end}}</p>
+<table>
+<tr>{{range .Columns}}<th{{with columnHelp .Title}} title="{{.}}"{{end}}>{{.Title}}</th>{{end}}</tr>
+{{range .Rows}}{{$row := .}}<tr>{{range $i, $cell := .}}<td>{{if eq $i 1}}<a href="{{recordPath (index $row 1) (index $row 2)}}">{{$cell}}</a>{{else}}{{$cell}}{{end}}</td>{{end}}</tr>
+{{end}}</table>
+{{template "foot" .}}{{end}}
+
+{{define "record"}}{{template "head" .}}
+<p><a href="/">&larr; all records</a></p>
+<h1>{{.Config.FQDN}} {{.Config.Type}}</h1>
+
+<h2>Values</h2>
+<table>
+<tr><th>Expected</th><td>{{values .State.PriorValues}}</td></tr>
+<tr><th>Currently</th><td>{{values .Current}}</td></tr>
+<tr><th>Difference</th><td>{{range .Added}}<span class="added">+ {{.}}</span><br>{{end}}{{range .Removed}}<span class="removed">- {{.}}</span><br>{{end}}{{if not (or .Added .Removed)}}none{{end}}</td></tr>
+<tr><th>Response</th><td>{{.State.Response}}</td></tr>
+<tr><th>Last checked</th><td>{{time .State.LastChecked}}</td></tr>
+<tr><th>Last resolved</th><td>{{time .State.LastSuccess}}</td></tr>
+{{with .State.ApprovedBy}}<tr><th>Approved by</th><td>{{.}} at {{time $.State.ApprovedAt}}</td></tr>{{end}}
+</table>
+
+<h2>Problems</h2>
+<ul>
+{{if .State.Errored}}<li>Couldn't be resolved, {{.State.Failures}} times in a row.</li>{{end}}
+{{if .State.Disagree}}<li>The resolvers disagree about the answer.</li>{{end}}
+{{if .State.UnexpectedResponse}}<li>Answered with {{.State.Response}} rather than {{.Config.ExpectResponse}}.</li>{{end}}
+{{if .State.Forbidden}}<li>Returned one of its forbidden values.</li>{{end}}
+{{if .State.Unacknowledged}}<li>This change is waiting to be approved.</li>{{end}}
+{{if .State.PendingChange}}<li>This change is waiting for {{.Config.Confirmations}} confirmations.</li>{{end}}
+{{with .State.DnssecReason}}<li>DNSSEC: {{.}}</li>{{end}}
+{{with .State.TTLReason}}<li>TTL: {{.}}</li>{{end}}
+{{with .State.SOAReason}}<li>SOA: {{.}}</li>{{end}}
+{{with .State.CacheError}}<li>Cache: {{.}}</li>{{end}}
+{{with .FlapSummary}}<li>Flapping, with {{range .}}{{.}}<br>{{end}}</li>{{end}}
+</ul>
+
+<h2>Resolvers</h2>
+<table>
+<tr><th>Resolver</th><th>Response</th><th>Values</th><th>Error</th></tr>
+{{range .State.Resolvers}}<tr{{if .Err}} class="alert"{{end}}><td>{{.Resolver}}</td><td>{{.Response}}</td><td>{{values .Values}}</td><td>{{with .Err}}{{.}}{{end}}</td></tr>
+{{end}}</table>
+
+<h2>History</h2>
+{{with .HistoryError}}<p>{{.}}</p>{{else}}<table>
+<tr><th>At</th><th>Response</th><th>Change</th><th>Resolver</th></tr>
+{{range .History}}<tr><td>{{time .At}}</td><td>{{.Response}}</td><td>{{range .Added}}<span class="added">+ {{.}}</span><br>{{end}}{{range .Removed}}<span class="removed">- {{.}}</span><br>{{end}}</td><td>{{.Resolver}}</td></tr>
+{{end}}</table>{{end}}
+{{template "foot" .}}{{end}}
+`))
+
+func setupWeb() {
+	ddrmHttpMux.HandleFunc(ddrmHttpPathWeb, handleWebRecords)
+	ddrmHttpMux.HandleFunc(ddrmHttpPathWebRecord, handleWebRecord)
+}
+
+// the web UI's page for a record
+func webRecordPath(fqdn string, recordType string) string {
+	return ddrmHttpPathWebRecord + url.PathEscape(fqdn) + "/" + url.PathEscape(recordType)
+}
+
+// refresh the web UI as often as records are processed, unless the refresh query parameter asks for longer
+func webRefresh(r *http.Request) int {
+	refresh := max(stateSleep, ddrmWebMinimumRefresh)
+
+	if seconds, err := strconv.Atoi(r.URL.Query().Get("refresh")); err == nil {
+		refresh = max(time.Duration(seconds)*time.Second, ddrmWebMinimumRefresh)
+	}
+
+	return int(refresh.Seconds())
+}
+
+// which values appear in after but not before, and which disappeared
+func valueDiff(before []string, after []string) (added []string, removed []string) {
+	for _, v := range after {
+		if !slices.Contains(before, v) {
+			added = append(added, v)
+		}
+	}
+
+	for _, v := range before {
+		if !slices.Contains(after, v) {
+			removed = append(removed, v)
+		}
+	}
+
+	return
+}
+
+func renderWeb(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := ddrmWebTemplates.ExecuteTemplate(w, name, data); err != nil {
+		dbgf(ddrmErrorWebTemplate, name, err)
+	}
+}
+
+// GET / shows the same record table as the TUI
+func handleWebRecords(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != ddrmHttpPathWeb {
+		http.NotFound(w, r)
+		return
+	}
+
+	renderWeb(w, "records", DdrmWebRecords{
+		Columns:     uiColumns(),
+		Rows:        uiRows(),
+		Refresh:     webRefresh(r),
+		Role:        leadershipRole(),
+		GeneratedAt: time.Now(),
+	})
+}
+
+// GET /records/<fqdn>/<type> shows everything about a single record, including its history
+func handleWebRecord(w http.ResponseWriter, r *http.Request) {
+	path, _ := strings.CutPrefix(r.URL.Path, ddrmHttpPathWebRecord)
+	fqdn, recordType, _ := strings.Cut(path, "/")
+
+	record, found := recordConfig(fqdn, DdrmRecordType(strings.ToUpper(recordType)))
+
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	state := getRecordState(record.FQDN + ":" + string(record.Type))
+
+	page := DdrmWebRecord{
+		Config:      record,
+		State:       state,
+		Current:     withTTLs(state.CurrentValues, state.TTLs),
+		Refresh:     webRefresh(r),
+		GeneratedAt: time.Now(),
+	}
+
+	page.Added, page.Removed = valueDiff(state.PriorValues, state.CurrentValues)
+
+	if state.Flap.Flapping {
+		page.FlapSummary = flapSummary(record, state.Flap)
+	}
+
+	if !stateUseCache {
+		page.HistoryError = ddrmErrorHistoryNeedsCache
+	} else if history, err := getCachedHistory(record.FQDN, record.Type, ddrmHistoryShown); err != nil {
+		page.HistoryError = err.Error()
+	} else {
+		for _, h := range history {
+			entry := DdrmWebHistoryEntry{DdrmHistoryEntry: h}
+			entry.Added, entry.Removed = valueDiff(h.OldValues, h.NewValues)
+
+			page.History = append(page.History, entry)
+		}
+	}
+
+	renderWeb(w, "record", page)
+}
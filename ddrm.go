@@ -21,8 +21,12 @@ func main() {
 	readAppConfig()
 	readRecordsConfig()
 
-	// Re-initialise the Redis cache if needed
+	// Re-initialise the Redis cache if needed, and pick the state store
 	reinitRedis()
+	setupStateStore()
+
+	// Run a subcommand and exit if one was given
+	runSubcommand()
 
 	// Run some tests and exit if requested
 	sendTestEmail()
@@ -31,6 +35,8 @@ func main() {
 	// Setup the TUI if needed, along with the periodic tasks
 	setupTui()
 	setupPeriodicTasks()
+	setupHttpServer()
+	setupReload()
 
 	// Run the record processor once outside the periodic scheduler just to prime the state
 	processRecords()